@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// backup holds a directory that was replaced or removed during the command, or
+// a file that was rewritten.
+type backup struct {
+	// dir is the original path of the directory, or of the file.
+	dir string
+	// path is the temporary directory holding the previous version of the
+	// directory, empty if there was none.
+	path string
+	// replaced is whether a new version was placed at the original path.
+	replaced bool
+	// file is whether the backup is of a rewritten file, whose previous
+	// contents are held in data.
+	file bool
+	data []byte
+}
+
+// backups lists the directories replaced or removed, and the files rewritten,
+// during the command, in order, kept until the command succeeds.
+var backups []backup
+
+// tempDirs lists the temporary directories created during the command, the
+// files rewritten inside them are new and not backed up.
+var tempDirs []string
+
+// tempDir creates a hidden temporary directory next to the `dir` directory,
+// on the same file system so it can be renamed into its place, creating the
+// parent directories as necessary.
+func tempDir(dir string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), "."+filepath.Base(dir)+".vend-")
+	if err != nil {
+		return "", err
+	}
+	tempDirs = append(tempDirs, tmp)
+	return tmp, os.Chmod(tmp, 0755)
+}
+
+// backupFile keeps the contents of the file at the `path` before it is
+// rewritten, restored by restoreBackups if the command fails. Only the first
+// version of a file is kept, files inside temporary directories are skipped,
+// see tempDir.
+func backupFile(path string) error {
+	for _, tmp := range tempDirs {
+		if isChildDir(tmp, path) {
+			return nil
+		}
+	}
+	for _, b := range backups {
+		if b.file && b.dir == path {
+			return nil
+		}
+	}
+	data, err := getFileContents(path)
+	if err != nil {
+		return err
+	}
+	backups = append(backups, backup{dir: path, file: true, data: data})
+	return nil
+}
+
+// replaceDir swaps the `tmp` directory into the place of the `dir` directory,
+// with renames, moving the previous version of the directory, if any, into a
+// backup, see backupDir.
+func replaceDir(tmp, dir string) error {
+	b := backup{dir: dir, replaced: true}
+	if _, err := os.Stat(dir); err == nil {
+		if b.path, err = moveAside(dir); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		if len(b.path) > 0 {
+			os.Rename(filepath.Join(b.path, filepath.Base(dir)), dir)
+			os.Remove(b.path)
+		}
+		return err
+	}
+	backups = append(backups, b)
+	return nil
+}
+
+// backupDir removes the `dir` directory by moving it into a backup, which is
+// deleted by commitBackups once the command succeeds, or moved back by
+// restoreBackups if it fails.
+func backupDir(dir string) error {
+	path, err := moveAside(dir)
+	if err != nil {
+		return err
+	}
+	backups = append(backups, backup{dir: dir, path: path})
+	return nil
+}
+
+// moveAside moves the `dir` directory into a hidden temporary directory next
+// to it, returns the temporary directory.
+func moveAside(dir string) (string, error) {
+	path, err := ioutil.TempDir(filepath.Dir(dir), "."+filepath.Base(dir)+".vend-backup-")
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(dir, filepath.Join(path, filepath.Base(dir))); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// commitBackups deletes the backups made during the command, once it
+// succeeds.
+// Returns the first error encountered, after attempting to delete all of them.
+func commitBackups() (err error) {
+	for _, b := range backups {
+		if len(b.path) == 0 {
+			continue
+		} else if rerr := os.RemoveAll(b.path); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	backups, tempDirs = nil, nil
+	return err
+}
+
+// restoreBackups moves the previous versions of the directories replaced or
+// removed during the command back into place, and writes back the previous
+// contents of the files rewritten, in reverse order, once it fails.
+// Directories that did not exist before are removed.
+// Returns the first error encountered, after attempting to restore all of
+// them.
+func restoreBackups() (err error) {
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		if b.file {
+			if rerr := writeFile(b.dir, b.data, 0644); rerr != nil && err == nil {
+				err = rerr
+			}
+			continue
+		} else if b.replaced {
+			if rerr := os.RemoveAll(b.dir); rerr != nil {
+				if err == nil {
+					err = rerr
+				}
+				continue
+			}
+		}
+		if len(b.path) == 0 {
+			continue
+		} else if rerr := os.Rename(filepath.Join(b.path, filepath.Base(b.dir)), b.dir); rerr != nil {
+			if err == nil {
+				err = rerr
+			}
+			continue
+		}
+		os.Remove(b.path)
+	}
+	backups, tempDirs = nil, nil
+	return err
+}
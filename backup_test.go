@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testNoTemp checks that there are no temporary or backup directories left in
+// the directory.
+func testNoTemp(t *testing.T, dir string) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		if strings.Contains(info.Name(), ".vend-") {
+			t.Errorf("temporary directory %s left in %s", info.Name(), dir)
+		}
+	}
+}
+
+// TestCpReplace tests that a forced copy replaces the destination with renames,
+// keeping the previous version as a backup until the command succeeds or fails,
+// along with the files whose imports are rewritten.
+func TestCpReplace(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	backups = nil
+	defer func(force bool) {
+		opt.force = force
+		backups = nil
+	}(opt.force)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	libDir := filepath.Join(pkgDir, "lib")
+	dstDir := filepath.Join(libDir, "y")
+	marker := filepath.Join(dstDir, "old.go")
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(marker, []byte("package y\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt.force = true
+	if err := cp(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, false); err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	testExists(t, marker, false)
+	testExists(t, filepath.Join(dstDir, "y.go"), true)
+	if info, err := os.Stat(dstDir); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("unexpected destination mode %v, %v", info, err)
+	}
+	// The command fails, the previous version is restored.
+	if err := restoreBackups(); err != nil {
+		t.Fatal(err)
+	}
+	testExists(t, marker, true)
+	testExists(t, filepath.Join(dstDir, "y.go"), false)
+	testNoTemp(t, libDir)
+	testImports(t, pkgDir, []string{"other.com/y"}, false)
+	// The command succeeds, the backup is removed.
+	if err := cp(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, false); err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	if err := commitBackups(); err != nil {
+		t.Fatal(err)
+	}
+	testExists(t, marker, false)
+	testExists(t, filepath.Join(dstDir, "y.go"), true)
+	testNoTemp(t, libDir)
+}
+
+// TestMvRestore tests that a moved source is kept as a backup, restored when
+// the command fails, along with removing the new copy and restoring the
+// rewritten imports.
+func TestMvRestore(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	backups = nil
+	defer func() {
+		backups = nil
+	}()
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	srcDir := filepath.Join(ctx.GOPATH, "src", "other.com", "y")
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	if err := mv(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, false); err != nil {
+		t.Fatalf("error during mv : %s", err.Error())
+	}
+	testExists(t, srcDir, false)
+	testExists(t, dstDir, true)
+	if err := restoreBackups(); err != nil {
+		t.Fatal(err)
+	}
+	testExists(t, filepath.Join(srcDir, "y.go"), true)
+	testExists(t, dstDir, false)
+	testNoTemp(t, filepath.Dir(srcDir))
+	testNoTemp(t, pkgDir)
+	testImports(t, pkgDir, []string{"other.com/y"}, false)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// leak is an import of a copied package that is not a standard package, not
+// located in the project, and not copied, see leakFilter.
+type leak struct {
+	// dir is the directory of the importing package.
+	dir string
+	// pos is the position of the import.
+	pos token.Position
+	// imp is the leaking import path.
+	imp string
+	// fix is the equivalent import path in a copy of the leaking package,
+	// empty if it has not been copied.
+	fix string
+}
+
+// check runs the check subcommand, outputs the position of every leaking import
+// of the packages located in the `dir` directory, relative paths are
+// resolved from the current working directory, which is expected to hold the
+// project's package.
+// With the opt.fix option set rewrites the leaking imports that have been
+// copied to import the copy, updating the records of the changed copies.
+// Returns an error if any leaking imports remain.
+func check(ctx *build.Context, cwd, dir string) error {
+	leaks, err := findLeaks(ctx, cwd, dir)
+	if err != nil {
+		return err
+	}
+	if opt.fix {
+		if leaks, err = fixLeaks(ctx, cwd, dir, leaks); err != nil {
+			return err
+		}
+	}
+	for _, l := range leaks {
+		file := l.pos.Filename
+		if rel, err := filepath.Rel(cwd, file); err == nil {
+			file = rel
+		}
+		if len(l.fix) > 0 {
+			fmt.Printf("%s:%d: %s, copied to %s\n", file, l.pos.Line, l.imp, l.fix)
+		} else {
+			fmt.Printf("%s:%d: %s\n", file, l.pos.Line, l.imp)
+		}
+	}
+	if len(leaks) > 0 {
+		return fmt.Errorf("found %d leaking imports", len(leaks))
+	}
+	return nil
+}
+
+// findLeaks compiles the leaking imports of the packages located in the `dir`
+// directory, sorted by position, see check. Every package is considered,
+// whether it is in a recorded copy or not, the records only identify the copies
+// and their origins.
+// Only the imports of non test files are considered, as for status.
+func findLeaks(ctx *build.Context, cwd, dir string) ([]leak, error) {
+	dir, err := cwdAbs(cwd, dir)
+	if err != nil {
+		return nil, err
+	}
+	projectImp, err := getImportPath(ctx, cwd, cwd)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := findRecords(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Map the import paths of the copies to their origins.
+	origins := make(map[string]string)
+	copies := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		imp, err := getImportPath(ctx, cwd, d)
+		if err != nil {
+			return nil, err
+		}
+		r, err := readRecord(d)
+		if err != nil {
+			return nil, fmt.Errorf("can't read record in %s : %s", d, err.Error())
+		}
+		origins[imp] = r.Origin
+		copies = append(copies, imp)
+	}
+	filter := leakFilter(ctx, cwd, projectImp, copies)
+	// fix finds the equivalent of the import in the copy with the closest
+	// origin, if the package exists in the copy.
+	fix := func(imp string) string {
+		var best, bestOrigin string
+		for _, c := range copies {
+			o := origins[c]
+			if isImportIn(o, imp) && len(o) > len(bestOrigin) {
+				best, bestOrigin = c, o
+			}
+		}
+		if len(best) == 0 {
+			return ""
+		}
+		np := best + strings.TrimPrefix(imp, bestOrigin)
+		if _, err := getPackage(ctx, cwd, np); err != nil {
+			return ""
+		}
+		return np
+	}
+	leaks := make([]leak, 0)
+	process := func(pkg *build.Package, err error) error {
+		if err != nil || len(pkg.Name) == 0 {
+			return nil
+		}
+		for _, imp := range filterImports(getImports(pkg, false), filter) {
+			np := fix(imp)
+			for _, pos := range pkg.ImportPos[imp] {
+				leaks = append(leaks, leak{pkg.Dir, pos, imp, np})
+			}
+		}
+		return nil
+	}
+	if err := recursePackages(context.Background(), ctx, dir, process); err != nil {
+		return nil, err
+	}
+	sort.Sort(byPosition(leaks))
+	return leaks, nil
+}
+
+// fixLeaks rewrites the leaking imports that have been copied to import the
+// copy, and updates the records of the copies located in the `dir` directory
+// that contain the changed packages.
+// Returns the leaks that could not be fixed.
+func fixLeaks(ctx *build.Context, cwd, dir string, leaks []leak) ([]leak, error) {
+	dir, err := cwdAbs(cwd, dir)
+	if err != nil {
+		return nil, err
+	}
+	projectImp, err := getImportPath(ctx, cwd, cwd)
+	if err != nil {
+		return nil, err
+	}
+	rws := make(map[string]map[string]string)
+	remaining := make([]leak, 0)
+	for _, l := range leaks {
+		if len(l.fix) == 0 {
+			remaining = append(remaining, l)
+			continue
+		}
+		if _, ok := rws[l.dir]; !ok {
+			rws[l.dir] = make(map[string]string)
+		}
+		rws[l.dir][l.imp] = l.fix
+	}
+	dirs, err := findRecords(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := newRewriter(ctx, cwd, projectImp)
+	changed := make([]string, 0)
+	for pkgDir, rw := range rws {
+		if opt.verbose {
+			fmt.Printf("rewriting imports in %s\n", pkgDir)
+		}
+		if err := r.withPaths(rw).rwDir(pkgDir); err != nil {
+			return nil, err
+		}
+		// Find the innermost copy containing the package.
+		var owner string
+		for _, d := range dirs {
+			if isChildDir(d, pkgDir) && len(d) > len(owner) {
+				owner = d
+			}
+		}
+		if len(owner) > 0 {
+			changed = appendUnique(changed, owner)
+		}
+	}
+	// Accept the rewritten files.
+	for _, d := range changed {
+		rec, err := readRecord(d)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Files, err = hashDir(d); err != nil {
+			return nil, err
+		}
+		if err := writeRecord(d, rec); err != nil {
+			return nil, err
+		}
+	}
+	return remaining, nil
+}
+
+// byPosition sorts leaks by the file name and line of their positions.
+type byPosition []leak
+
+func (s byPosition) Len() int      { return len(s) }
+func (s byPosition) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byPosition) Less(i, j int) bool {
+	if s[i].pos.Filename != s[j].pos.Filename {
+		return s[i].pos.Filename < s[j].pos.Filename
+	}
+	return s[i].pos.Line < s[j].pos.Line
+}
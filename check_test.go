@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheck tests finding the leaking imports of the packages in the directory,
+// copied or not, and fixing the ones that have been copied.
+func TestCheck(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func(fix bool) {
+		opt.fix = fix
+	}(opt.fix)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"), dstDir, false, false)
+	if err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	if leaks, err := findLeaks(ctx, pkgDir, "lib"); err != nil {
+		t.Fatal(err)
+	} else if len(leaks) != 0 {
+		t.Errorf("fresh copy leaks : %+v", leaks)
+	}
+	// Add imports of a copied and an unknown package.
+	leakPath := filepath.Join(dstDir, "leak.go")
+	src := "package y\n\nimport (\n\t_ \"other.com/y/sub\"\n\t_ \"other.com/z\"\n)\n"
+	if err := ioutil.WriteFile(leakPath, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	leaks, err := findLeaks(ctx, pkgDir, "lib")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(leaks) != 2 {
+		t.Fatalf("expected two leaks, got %+v", leaks)
+	}
+	expected := []leak{
+		{imp: "other.com/y/sub", fix: "example.com/x/lib/y/sub"},
+		{imp: "other.com/z"},
+	}
+	for i, l := range leaks {
+		if l.pos.Filename != leakPath || l.pos.Line != i+4 ||
+			l.imp != expected[i].imp || l.fix != expected[i].fix {
+			t.Errorf("unexpected leak %d : %+v", i, l)
+		}
+	}
+	if err := check(ctx, pkgDir, "lib"); err == nil {
+		t.Errorf("expected an error for leaking imports")
+	}
+	// Fix the copied import.
+	opt.fix = true
+	if err := check(ctx, pkgDir, "lib"); err == nil {
+		t.Errorf("expected an error for the remaining leaking import")
+	}
+	out, err := getFileContents(leakPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(out), `"example.com/x/lib/y/sub"`) ||
+		!strings.Contains(string(out), `"other.com/z"`) {
+		t.Errorf("unexpected fixed file :\n%s", out)
+	}
+	if leaks, err = findLeaks(ctx, pkgDir, "lib"); err != nil {
+		t.Fatal(err)
+	} else if len(leaks) != 1 || leaks[0].imp != "other.com/z" {
+		t.Errorf("expected one remaining leak, got %+v", leaks)
+	}
+	// The fixed file is accepted in the record.
+	r, err := readRecord(dstDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := hashDir(dstDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added, removed, modified := compareDigests(r.Files, files); len(added)+len(removed)+len(modified) > 0 {
+		t.Errorf("record not updated, changed %v %v %v", added, removed, modified)
+	}
+	// Packages without a record are checked as well.
+	opt.fix = false
+	unrecorded := filepath.Join(pkgDir, "lib", "u", "u.go")
+	if err := os.MkdirAll(filepath.Dir(unrecorded), 0755); err != nil {
+		t.Fatal(err)
+	}
+	src = "package u\n\nimport _ \"other.com/y\"\n"
+	if err := ioutil.WriteFile(unrecorded, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if leaks, err = findLeaks(ctx, pkgDir, "lib"); err != nil {
+		t.Fatal(err)
+	} else if len(leaks) != 2 || leaks[0].pos.Filename != unrecorded ||
+		leaks[0].fix != "example.com/x/lib/y" {
+		t.Errorf("expected a leak in the package without a record, got %+v", leaks)
+	}
+}
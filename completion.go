@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// argKind is the kind of a positional argument of a subcommand, determines how
+// it is completed.
+type argKind int
+
+const (
+	argNone     argKind = iota // not completed
+	argDir                     // a directory
+	argImport                  // an import path in the GOPATH
+	argVendored                // a copied package in the project
+	argWords                   // one of the words in completionWords
+)
+
+// completionArgs maps a subcommand to the kinds of its positional arguments.
+var completionArgs = map[string][]argKind{
+	"init":       {argDir},
+	"cp":         {argImport, argDir},
+	"mv":         {argVendored, argDir},
+	"get":        {argDir, argNone, argDir},
+	"path":       {argImport, argImport},
+	"prune":      {argDir},
+	"verify":     {argDir},
+	"diff":       {argVendored, argImport},
+	"patch":      {argWords, argVendored},
+	"status":     {argDir},
+	"check":      {argDir},
+	"list":       {argImport},
+	"info":       {argImport},
+	"why":        {argImport},
+	"completion": {argWords},
+}
+
+// completionWords maps a subcommand to the words its first positional
+// argument is completed with.
+var completionWords = map[string][]string{
+	"patch":      {"save", "apply"},
+	"completion": {"bash", "zsh", "fish"},
+}
+
+// completion runs the completion subcommand, writes the completion script for
+// the shell, bash, zsh, or fish, named by the first argument to the writer.
+// The scripts are derived from the subcommands and flags in flagMap, and call
+// back into the subcommand to complete import paths, with the imports
+// argument, and copied packages, with the vendored argument, matching the
+// prefix in the second argument.
+func completion(ctx *build.Context, cwd string, w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing shell")
+	}
+	var prefix string
+	if len(args) > 1 {
+		prefix = args[1]
+	}
+	switch args[0] {
+	case "bash":
+		_, err := io.WriteString(w, bashCompletion())
+		return err
+	case "zsh":
+		_, err := io.WriteString(w, "autoload -U +X bashcompinit && bashcompinit\n"+bashCompletion())
+		return err
+	case "fish":
+		_, err := io.WriteString(w, fishCompletion())
+		return err
+	case "imports":
+		for _, imp := range completeImports(ctx, prefix) {
+			fmt.Fprintln(w, imp)
+		}
+		return nil
+	case "vendored":
+		dirs, err := completeVendored(cwd, prefix)
+		if err != nil {
+			return err
+		}
+		for _, d := range dirs {
+			fmt.Fprintln(w, d)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported shell %s", args[0])
+}
+
+// subcommands returns the sorted names of the subcommands in flagMap.
+func subcommands() []string {
+	cmds := make([]string, 0, len(flagMap))
+	for name := range flagMap {
+		if name != "main" {
+			cmds = append(cmds, name)
+		}
+	}
+	sort.Strings(cmds)
+	return cmds
+}
+
+// completionFlag describes a flag for completion.
+type completionFlag struct {
+	name, usage string
+	// value is whether the flag takes a value in the next argument.
+	value bool
+}
+
+// subcommandFlags returns the flags of the subcommand, sorted by name.
+func subcommandFlags(cmd string) []completionFlag {
+	flags := make([]completionFlag, 0)
+	flagMap[cmd].VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface {
+			IsBoolFlag() bool
+		})
+		flags = append(flags, completionFlag{f.Name, f.Usage, !ok || !b.IsBoolFlag()})
+	})
+	return flags
+}
+
+// valueFlags returns the sorted names of all the flags that take a value, with
+// a dash.
+func valueFlags() []string {
+	names := make([]string, 0)
+	for _, cmd := range subcommands() {
+		for _, f := range subcommandFlags(cmd) {
+			if f.value {
+				names = appendUnique(names, "-"+f.name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bashCompletion generates the completion script for bash, also used for zsh
+// through bashcompinit.
+func bashCompletion() string {
+	var buf bytes.Buffer
+	buf.WriteString("# bash completion for vend, generated by vend completion bash\n\n")
+	buf.WriteString("_vend() {\n")
+	buf.WriteString("\tlocal cur cmd i n\n")
+	buf.WriteString("\tcur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(&buf, "\tif [ \"$COMP_CWORD\" -eq 1 ]; then\n"+
+		"\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n"+
+		"\t\treturn\n\tfi\n", strings.Join(subcommands(), " "))
+	buf.WriteString("\tcmd=\"${COMP_WORDS[1]}\"\n")
+	// Flags.
+	buf.WriteString("\tif [[ \"$cur\" == -* ]]; then\n\t\tcase \"$cmd\" in\n")
+	for _, cmd := range subcommands() {
+		names := make([]string, 0)
+		for _, f := range subcommandFlags(cmd) {
+			names = append(names, "-"+f.name)
+		}
+		if len(names) > 0 {
+			fmt.Fprintf(&buf, "\t\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n",
+				cmd, strings.Join(names, " "))
+		}
+	}
+	buf.WriteString("\t\tesac\n\t\treturn\n\tfi\n")
+	// Count the positional arguments before the current one, skipping flag
+	// values.
+	buf.WriteString("\tn=0\n\tfor ((i=2; i<COMP_CWORD; i++)); do\n" +
+		"\t\tcase \"${COMP_WORDS[i]}\" in\n")
+	if vf := valueFlags(); len(vf) > 0 {
+		fmt.Fprintf(&buf, "\t\t%s) i=$((i+1)) ;;\n", strings.Join(vf, "|"))
+	}
+	buf.WriteString("\t\t-*) ;;\n\t\t*) n=$((n+1)) ;;\n\t\tesac\n\tdone\n")
+	// Positional arguments.
+	buf.WriteString("\tcase \"$cmd $n\" in\n")
+	for _, cmd := range subcommands() {
+		for i, kind := range completionArgs[cmd] {
+			var reply string
+			switch kind {
+			case argDir:
+				reply = "$(compgen -d -- \"$cur\")"
+			case argImport:
+				reply = "$(vend completion imports \"$cur\")"
+			case argVendored:
+				reply = "$(vend completion vendored \"$cur\")"
+			case argWords:
+				reply = fmt.Sprintf("$(compgen -W %q -- \"$cur\")",
+					strings.Join(completionWords[cmd], " "))
+			default:
+				continue
+			}
+			fmt.Fprintf(&buf, "\t\"%s %d\") COMPREPLY=(%s) ;;\n", cmd, i, reply)
+		}
+	}
+	buf.WriteString("\tesac\n}\n\ncomplete -F _vend vend\n")
+	return buf.String()
+}
+
+// fishCompletion generates the completion script for fish.
+func fishCompletion() string {
+	var buf bytes.Buffer
+	buf.WriteString("# fish completion for vend, generated by vend completion fish\n\n")
+	// Helper that counts the positional arguments after the subcommand,
+	// skipping flag values.
+	buf.WriteString("function __vend_arg\n" +
+		"\tset -l n 0\n\tset -l skip 0\n" +
+		"\tfor t in (commandline -opc)[3..-1]\n" +
+		"\t\tif test $skip -eq 1\n\t\t\tset skip 0\n\t\t\tcontinue\n\t\tend\n" +
+		"\t\tswitch $t\n")
+	if vf := valueFlags(); len(vf) > 0 {
+		fmt.Fprintf(&buf, "\t\t\tcase %s\n\t\t\t\tset skip 1\n", strings.Join(vf, " "))
+	}
+	buf.WriteString("\t\t\tcase '-*'\n\t\t\tcase '*'\n\t\t\t\tset n (math $n + 1)\n" +
+		"\t\tend\n\tend\n\techo $n\nend\n\n")
+	buf.WriteString("complete -c vend -f\n")
+	fmt.Fprintf(&buf, "complete -c vend -n __fish_use_subcommand -a %q\n",
+		strings.Join(subcommands(), " "))
+	for _, cmd := range subcommands() {
+		seen := "__fish_seen_subcommand_from " + cmd
+		for _, f := range subcommandFlags(cmd) {
+			fmt.Fprintf(&buf, "complete -c vend -n '%s' -o %s", seen, f.name)
+			if f.value {
+				buf.WriteString(" -r")
+			}
+			fmt.Fprintf(&buf, " -d %s\n", fishQuote(f.usage))
+		}
+		for i, kind := range completionArgs[cmd] {
+			var args string
+			switch kind {
+			case argDir:
+				args = "(__fish_complete_directories (commandline -ct))"
+			case argImport:
+				args = "(vend completion imports (commandline -ct))"
+			case argVendored:
+				args = "(vend completion vendored (commandline -ct))"
+			case argWords:
+				args = strings.Join(completionWords[cmd], " ")
+			default:
+				continue
+			}
+			fmt.Fprintf(&buf, "complete -c vend -n '%s; and test (__vend_arg) -eq %d' -a '%s'\n",
+				seen, i, args)
+		}
+	}
+	return buf.String()
+}
+
+// fishQuote quotes the string for fish in single quotes.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// completeImports completes the last element of the import path prefix, with
+// the directories found in the GOROOT and GOPATH src directories. Skips
+// hidden directories and directories ignored by the go tool.
+func completeImports(ctx *build.Context, prefix string) []string {
+	parent, base := "", prefix
+	if i := strings.LastIndex(prefix, "/"); i != -1 {
+		parent, base = prefix[:i], prefix[i+1:]
+	}
+	srcs := []string{filepath.Join(ctx.GOROOT, "src")}
+	for _, p := range filepath.SplitList(ctx.GOPATH) {
+		srcs = append(srcs, filepath.Join(p, "src"))
+	}
+	imps := make([]string, 0)
+	for _, src := range srcs {
+		infos, err := ioutil.ReadDir(filepath.Join(src, filepath.FromSlash(parent)))
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			name := info.Name()
+			if !info.IsDir() || !strings.HasPrefix(name, base) ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+				name == "testdata" {
+				continue
+			}
+			imps = appendUnique(imps, pathpkg.Join(parent, name))
+		}
+	}
+	sort.Strings(imps)
+	return imps
+}
+
+// completeVendored returns the slash separated paths, relative to the current
+// working directory, of the copied packages located in it that match the
+// prefix.
+func completeVendored(cwd, prefix string) ([]string, error) {
+	records, err := findRecords(cwd)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]string, 0)
+	for _, d := range records {
+		rel, err := filepath.Rel(cwd, d)
+		if err != nil || rel == "." {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(rel, strings.TrimPrefix(prefix, "./")) {
+			dirs = append(dirs, rel)
+		}
+	}
+	return dirs, nil
+}
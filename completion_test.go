@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCompletionScripts tests that the completion scripts cover the
+// subcommands, their flags, and arguments, and that the bash script is valid.
+func TestCompletionScripts(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var buf bytes.Buffer
+		if err := completion(nil, "", &buf, []string{shell}); err != nil {
+			t.Fatalf("%s : %s", shell, err.Error())
+		}
+		for _, s := range []string{"init", "cp", "status", "group", "vend completion imports", "vend completion vendored"} {
+			if !strings.Contains(buf.String(), s) {
+				t.Errorf("%s completion missing %q", shell, s)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := completion(nil, "", &buf, []string{"bash"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"\t\"cp 0\") COMPREPLY=($(vend completion imports \"$cur\")) ;;\n",
+		"\t\"cp 1\") COMPREPLY=($(compgen -d -- \"$cur\")) ;;\n",
+		"\t\t-copy-mode|-import) i=$((i+1)) ;;\n",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("bash completion missing %q", s)
+		}
+	}
+	if _, err := exec.LookPath("bash"); err == nil {
+		cmd := exec.Command("bash", "-n")
+		cmd.Stdin = &buf
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("invalid bash script : %s", out)
+		}
+	}
+	if err := completion(nil, "", &buf, []string{"tcsh"}); err == nil {
+		t.Error("expected error for unsupported shell")
+	}
+}
+
+// TestCompleteImports tests completing the last element of import paths from
+// the GOPATH.
+func TestCompleteImports(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	tests := map[string][]string{
+		"oth":          {"other.com"},
+		"other.com/":   {"other.com/y"},
+		"other.com/y/": {"other.com/y/sub"},
+		"other.com/z":  {},
+	}
+	for prefix, expected := range tests {
+		got := completeImports(ctx, prefix)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("completing %q : got %v, expected %v", prefix, got, expected)
+		}
+	}
+	// Standard packages.
+	if got := completeImports(ctx, "encoding/js"); !reflect.DeepEqual(got, []string{"encoding/json"}) {
+		t.Errorf("completing standard package : got %v", got)
+	}
+}
+
+// TestCompleteVendored tests completing the copied packages in the project.
+func TestCompleteVendored(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	if err := cp(context.Background(), ctx, pkgDir, "other.com/y", filepath.Join("lib", "y"), false, false); err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	for prefix, expected := range map[string][]string{
+		"":      {"lib/y"},
+		"./l":   {"lib/y"},
+		"other": {},
+	} {
+		got, err := completeVendored(pkgDir, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("completing %q : got %v, expected %v", prefix, got, expected)
+		}
+	}
+}
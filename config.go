@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/build"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Names of the configuration files, looked for in the project's root
+// directory.
+const (
+	configJSONName = ".vend.json"
+	configTOMLName = ".vend.toml"
+)
+
+// flagDefaults holds defaults for the flags of the subcommands, unset fields
+// leave the defaults of the flags alone.
+type flagDefaults struct {
+	// Recurse sets the default of the -r flag.
+	Recurse *bool `json:"recurse"`
+	// Hidden sets the default of the -i flag.
+	Hidden *bool `json:"hidden"`
+	// Force sets the default of the -f flag.
+	Force *bool `json:"force"`
+	// Verbose sets the default of the -v flag.
+	Verbose *bool `json:"verbose"`
+}
+
+// config holds the project configuration, read from a configuration file in the
+// project's root directory and from environment variables.
+type config struct {
+	// flagDefaults holds the flag defaults for all the subcommands.
+	flagDefaults
+	// Dir is the default directory for copied packages, used when the
+	// directory argument is omitted.
+	Dir string `json:"dir"`
+	// Exclude lists patterns, as matched by path.Match, of import paths that
+	// the init subcommand does not copy.
+	Exclude []string `json:"exclude"`
+	// Names maps import paths to the names of the directories the init
+	// subcommand copies them into, instead of their package names.
+	Names map[string]string `json:"names"`
+	// Commands maps a subcommand to flag defaults that take precedence over
+	// the defaults for all the subcommands.
+	Commands map[string]flagDefaults `json:"commands"`
+	// env holds the flag defaults set in environment variables, they take
+	// precedence over the configuration file.
+	env flagDefaults
+}
+
+// conf is the configuration of the project in the current working directory.
+var conf *config = &config{}
+
+// loadConfig reads the configuration of the project containing the `dir`
+// directory, from either a .vend.json or a .vend.toml file in its root
+// directory, see projectRoot, then applies the overrides set in VEND_*
+// environment variables.
+// A relative directory for copied packages set in the configuration file is
+// resolved from the project's root directory.
+// Returns an empty configuration if there is no configuration file and no
+// overrides.
+func loadConfig(ctx *build.Context, dir string) (*config, error) {
+	dir = projectRoot(ctx, dir)
+	c := &config{}
+	if src, err := getFileContents(filepath.Join(dir, configJSONName)); err == nil {
+		if err := json.Unmarshal(src, c); err != nil {
+			return nil, fmt.Errorf("%s : %s", configJSONName, err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	} else if src, err := getFileContents(filepath.Join(dir, configTOMLName)); err == nil {
+		t, err := parseTOML(src)
+		if err != nil {
+			return nil, fmt.Errorf("%s : %s", configTOMLName, err.Error())
+		}
+		// Decode through JSON to share the field mapping.
+		out, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(out, c); err != nil {
+			return nil, fmt.Errorf("%s : %s", configTOMLName, err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(c.Dir) > 0 && !filepath.IsAbs(c.Dir) {
+		c.Dir = filepath.Join(dir, c.Dir)
+	}
+	if err := c.setEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// projectRoot returns the root directory of the project containing the `dir`
+// directory, the closest directory holding a configuration file or the root of
+// a Git or Mercurial working copy, without leaving the directory's location in
+// the GOPATH or the GOROOT. Returns the `dir` directory if there is none.
+func projectRoot(ctx *build.Context, dir string) string {
+	stops := []string{filepath.Join(ctx.GOROOT, "src")}
+	for _, p := range filepath.SplitList(ctx.GOPATH) {
+		stops = append(stops, filepath.Join(p, "src"))
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if hasString(stops, d) {
+			break
+		}
+		for _, name := range []string{configJSONName, configTOMLName, ".git", ".hg"} {
+			if _, err := os.Stat(filepath.Join(d, name)); err == nil {
+				return d
+			}
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return dir
+}
+
+// setEnv applies the overrides set in the VEND_RECURSE, VEND_HIDDEN,
+// VEND_FORCE, VEND_VERBOSE, VEND_DIR, VEND_EXCLUDE, and VEND_NAMES environment
+// variables, looked up with the passed function.
+// VEND_EXCLUDE holds comma separated patterns and VEND_NAMES holds comma
+// separated import path and name pairs, such as "github.com/lib/pq=pq2", which
+// override the names configured for those import paths.
+// Flag overrides apply to all the subcommands, taking precedence over any
+// subcommand specific defaults.
+func (c *config) setEnv(getenv func(string) string) error {
+	bools := []struct {
+		name string
+		dst  **bool
+	}{
+		{"VEND_RECURSE", &c.env.Recurse},
+		{"VEND_HIDDEN", &c.env.Hidden},
+		{"VEND_FORCE", &c.env.Force},
+		{"VEND_VERBOSE", &c.env.Verbose},
+	}
+	for _, b := range bools {
+		v := getenv(b.name)
+		if len(v) == 0 {
+			continue
+		}
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s : invalid boolean %q", b.name, v)
+		}
+		*b.dst = &parsed
+	}
+	if v := getenv("VEND_DIR"); len(v) > 0 {
+		c.Dir = v
+	}
+	if v := getenv("VEND_EXCLUDE"); len(v) > 0 {
+		c.Exclude = splitList(v)
+	}
+	if v := getenv("VEND_NAMES"); len(v) > 0 {
+		if c.Names == nil {
+			c.Names = make(map[string]string)
+		}
+		for _, pair := range splitList(v) {
+			i := strings.Index(pair, "=")
+			if i < 1 || i == len(pair)-1 {
+				return fmt.Errorf("VEND_NAMES : invalid pair %q", pair)
+			}
+			c.Names[pair[:i]] = pair[i+1:]
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, trimming spaces and dropping empty
+// elements.
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); len(e) > 0 {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// seedFlags sets the defaults configured for the subcommand on its FlagSet,
+// before it parses the command line, so flags passed on the command line
+// still take precedence. Environment variables take precedence over the
+// subcommand's defaults, which take precedence over the defaults for all the
+// subcommands. Skips flags the FlagSet does not define.
+func (c *config) seedFlags(cmd string, fs *flag.FlagSet) error {
+	d := c.Commands[cmd]
+	seeds := []struct {
+		name string
+		vs   []*bool // in order of precedence
+	}{
+		{"r", []*bool{c.env.Recurse, d.Recurse, c.Recurse}},
+		{"i", []*bool{c.env.Hidden, d.Hidden, c.Hidden}},
+		{"f", []*bool{c.env.Force, d.Force, c.Force}},
+		{"v", []*bool{c.env.Verbose, d.Verbose, c.Verbose}},
+	}
+	for _, s := range seeds {
+		var v *bool
+		for _, p := range s.vs {
+			if p != nil {
+				v = p
+				break
+			}
+		}
+		if v == nil || fs.Lookup(s.name) == nil {
+			continue
+		}
+		if err := fs.Set(s.name, strconv.FormatBool(*v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// excluded checks whether the import path matches any of the exclude patterns.
+func (c *config) excluded(imp string) bool {
+	for _, p := range c.Exclude {
+		if ok, _ := pathpkg.Match(p, imp); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTOML parses the subset of TOML used by configuration files into a map,
+// as it would be decoded from JSON. Supports comments, tables with dotted
+// names, and key value pairs with bare or quoted keys, where the value is a
+// boolean, a basic or literal string, or an array of strings on a single line.
+func parseTOML(src []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+	for n, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		lineErr := func(msg string) error {
+			return fmt.Errorf("line %d : %s", n+1, msg)
+		}
+		if line[0] == '[' {
+			// Table header.
+			table = root
+			rest := strings.TrimSpace(line[1:])
+			for {
+				key, r, err := tomlKey(rest)
+				if err != nil {
+					return nil, lineErr(err.Error())
+				}
+				sub, ok := table[key].(map[string]interface{})
+				if !ok {
+					if _, exists := table[key]; exists {
+						return nil, lineErr(fmt.Sprintf("%s is not a table", key))
+					}
+					sub = make(map[string]interface{})
+					table[key] = sub
+				}
+				table = sub
+				if rest = strings.TrimSpace(r); strings.HasPrefix(rest, ".") {
+					rest = strings.TrimSpace(rest[1:])
+					continue
+				}
+				break
+			}
+			if !strings.HasPrefix(rest, "]") || len(tomlTrimComment(rest[1:])) > 0 {
+				return nil, lineErr("invalid table header")
+			}
+			continue
+		}
+		key, rest, err := tomlKey(line)
+		if err != nil {
+			return nil, lineErr(err.Error())
+		}
+		if rest = strings.TrimSpace(rest); !strings.HasPrefix(rest, "=") {
+			return nil, lineErr("expected = after key")
+		}
+		v, rest, err := tomlValue(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return nil, lineErr(err.Error())
+		}
+		if rest = tomlTrimComment(rest); len(rest) > 0 {
+			return nil, lineErr(fmt.Sprintf("unexpected %q after value", rest))
+		}
+		if _, exists := table[key]; exists {
+			return nil, lineErr(fmt.Sprintf("duplicate key %s", key))
+		}
+		table[key] = v
+	}
+	return root, nil
+}
+
+// tomlKey reads a bare or quoted key from the start of the string, returns the
+// key and the rest of the string.
+func tomlKey(s string) (key, rest string, err error) {
+	if len(s) > 0 && (s[0] == '"' || s[0] == '\'') {
+		return tomlString(s)
+	}
+	i := 0
+	for i < len(s) && (s[i] == '_' || s[i] == '-' ||
+		('a' <= s[i] && s[i] <= 'z') || ('A' <= s[i] && s[i] <= 'Z') ||
+		('0' <= s[i] && s[i] <= '9')) {
+		i++
+	}
+	if i == 0 {
+		return "", "", fmt.Errorf("expected key")
+	}
+	return s[:i], s[i:], nil
+}
+
+// tomlString reads a basic, double quoted, or a literal, single quoted, string
+// from the start of the string, returns its value and the rest of the string.
+func tomlString(s string) (v, rest string, err error) {
+	if strings.HasPrefix(s, "'") {
+		i := strings.Index(s[1:], "'")
+		if i == -1 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : i+1], s[i+2:], nil
+	}
+	// Basic string, with the TOML escape sequences.
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return b.String(), s[i+1:], nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'u', 'U':
+				n := 4
+				if s[i] == 'U' {
+					n = 8
+				}
+				if i+n >= len(s) {
+					return "", "", fmt.Errorf("invalid escape \\%s", s[i:])
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", "", fmt.Errorf("invalid escape \\%s", s[i:i+1+n])
+				}
+				b.WriteRune(rune(r))
+				i += n
+			default:
+				return "", "", fmt.Errorf("invalid escape \\%c", s[i])
+			}
+		case c < 0x20 && c != '\t' || c == 0x7f:
+			return "", "", fmt.Errorf("invalid control character in string")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// tomlQuote returns the string as a TOML basic string, double quoted, read back
+// by tomlString. Escapes quotes, backslashes, and control characters, other
+// characters are written as UTF-8, invalid bytes are replaced.
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\b':
+			b.WriteString(`\b`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// tomlValue reads a value from the start of the string, returns the value and
+// the rest of the string.
+func tomlValue(s string) (v interface{}, rest string, err error) {
+	switch {
+	case strings.HasPrefix(s, "true"):
+		return true, s[len("true"):], nil
+	case strings.HasPrefix(s, "false"):
+		return false, s[len("false"):], nil
+	case strings.HasPrefix(s, "\""), strings.HasPrefix(s, "'"):
+		return tomlString(s)
+	case strings.HasPrefix(s, "["):
+		list := make([]interface{}, 0)
+		rest = strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(rest, "]") {
+			var e string
+			if e, rest, err = tomlString(rest); err != nil {
+				return nil, "", fmt.Errorf("expected string in array")
+			}
+			list = append(list, e)
+			if rest = strings.TrimSpace(rest); strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", fmt.Errorf("unterminated array")
+			}
+		}
+		return list, rest[1:], nil
+	}
+	return nil, "", fmt.Errorf("unsupported value %q", s)
+}
+
+// tomlTrimComment trims spaces and a trailing comment from the string.
+func tomlTrimComment(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "#") {
+		return ""
+	}
+	return s
+}
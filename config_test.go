@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestParseTOML tests parsing the subset of TOML supported in configuration
+// files.
+func TestParseTOML(t *testing.T) {
+	src := "# vend configuration\n" +
+		"dir = \"lib\" # copies\n" +
+		"recurse = true\n" +
+		"exclude = [\"golang.org/x/*\", 'example.com/internal']\n\n" +
+		"[names]\n" +
+		"\"github.com/lib/pq\" = \"pq2\"\n\n" +
+		"[commands.init]\n" +
+		"verbose = false\n"
+	got, err := parseTOML([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"dir":     "lib",
+		"recurse": true,
+		"exclude": []interface{}{"golang.org/x/*", "example.com/internal"},
+		"names": map[string]interface{}{
+			"github.com/lib/pq": "pq2",
+		},
+		"commands": map[string]interface{}{
+			"init": map[string]interface{}{"verbose": false},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+	// TOML escape sequences, rather than Go ones.
+	got, err = parseTOML([]byte(`a = "tab\there \"q\" \\ \u00e9 \U0001F600"` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	} else if got["a"] != "tab\there \"q\" \\ \u00e9 \U0001F600" {
+		t.Errorf("got %q", got["a"])
+	}
+	// Errors are reported with the line number.
+	for src, msg := range map[string]string{
+		"dir = lib\n":              "line 1 : unsupported value \"lib\"",
+		"\n[names\n":               "line 2 : invalid table header",
+		"dir = \"a\"\ndir = \"b\"": "line 2 : duplicate key dir",
+		"exclude = [\"a\"":         "line 1 : unterminated array",
+		"dir = \"a\\xff\"":         "line 1 : invalid escape \\x",
+		"dir = \"\\u12\"":          "line 1 : invalid escape \\u12\"",
+	} {
+		if _, err := parseTOML([]byte(src)); err == nil || err.Error() != msg {
+			t.Errorf("parsing %q : got error %v, expected %s", src, err, msg)
+		}
+	}
+}
+
+// TestLoadConfig tests that JSON and TOML configuration files are decoded the
+// same way and that environment variables override them.
+func TestLoadConfig(t *testing.T) {
+	files := map[string]string{
+		configJSONName: `{"dir": "lib", "recurse": true, "names": {"a/x": "y"}, "commands": {"cp": {"force": true}}}`,
+		configTOMLName: "dir = \"lib\"\nrecurse = true\n[names]\n\"a/x\" = \"y\"\n[commands.cp]\nforce = true\n",
+	}
+	yes := true
+	for name, src := range files {
+		dir, err := ioutil.TempDir("", "vend")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// The configuration of the project's root directory applies in
+		// its subdirectories.
+		sub := filepath.Join(dir, "a", "b")
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		c, err := loadConfig(&build.Default, sub)
+		if err != nil {
+			t.Fatalf("%s : %s", name, err.Error())
+		}
+		expected := &config{
+			flagDefaults: flagDefaults{Recurse: &yes},
+			Dir:          filepath.Join(dir, "lib"),
+			Names:        map[string]string{"a/x": "y"},
+			Commands:     map[string]flagDefaults{"cp": {Force: &yes}},
+		}
+		if !reflect.DeepEqual(c, expected) {
+			t.Errorf("%s : got %+v, expected %+v", name, c, expected)
+		}
+	}
+	// Environment variables.
+	env := map[string]string{
+		"VEND_FORCE":   "false",
+		"VEND_DIR":     "vendor",
+		"VEND_EXCLUDE": "a/*, b",
+		"VEND_NAMES":   "a/x=ax,b/y=by",
+	}
+	c := &config{Names: map[string]string{"a/x": "x", "c/z": "z"}}
+	if err := c.setEnv(func(k string) string { return env[k] }); err != nil {
+		t.Fatal(err)
+	}
+	if c.env.Force == nil || *c.env.Force || c.Dir != "vendor" ||
+		!reflect.DeepEqual(c.Exclude, []string{"a/*", "b"}) ||
+		!reflect.DeepEqual(c.Names, map[string]string{"a/x": "ax", "b/y": "by", "c/z": "z"}) {
+		t.Errorf("environment not applied : %+v", c)
+	}
+	env = map[string]string{"VEND_RECURSE": "maybe"}
+	if err := c.setEnv(func(k string) string { return env[k] }); err == nil {
+		t.Error("expected error for invalid boolean")
+	}
+}
+
+// TestSeedFlags tests the precedence of the flag defaults, the command line
+// over environment variables over subcommand defaults over defaults for all
+// subcommands.
+func TestSeedFlags(t *testing.T) {
+	yes, no := true, false
+	c := &config{
+		flagDefaults: flagDefaults{Recurse: &yes, Hidden: &yes, Verbose: &yes},
+		Commands:     map[string]flagDefaults{"cp": {Recurse: &no, Force: &yes}},
+		env:          flagDefaults{Verbose: &no},
+	}
+	var recurse, hidden, force, verbose bool
+	fs := flag.NewFlagSet("cp", flag.ContinueOnError)
+	fs.BoolVar(&recurse, "r", false, "")
+	fs.BoolVar(&hidden, "i", false, "")
+	fs.BoolVar(&force, "f", false, "")
+	fs.BoolVar(&verbose, "v", true, "")
+	if err := c.seedFlags("cp", fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse([]string{"-i=false"}); err != nil {
+		t.Fatal(err)
+	}
+	if recurse || hidden || !force || verbose {
+		t.Errorf("got recurse %t, hidden %t, force %t, verbose %t",
+			recurse, hidden, force, verbose)
+	}
+	// Flags not defined by the FlagSet are skipped.
+	if err := c.seedFlags("info", flag.NewFlagSet("info", flag.ContinueOnError)); err != nil {
+		t.Errorf("unexpected error %s", err.Error())
+	}
+}
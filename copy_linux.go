@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// ficlone returns the FICLONE ioctl request, which shares the extents of a
+// file with another on file systems that support it, as encoded by the
+// architecture.
+func ficlone() uintptr {
+	switch runtime.GOARCH {
+	case "ppc64", "ppc64le", "mips", "mipsle", "mips64", "mips64le":
+		return 0x80049409
+	}
+	return 0x40049409
+}
+
+// sysSyncfs is the number of the syncfs system call on the architecture, zero
+// if unknown, missing from the syscall package on some architectures.
+var sysSyncfs = map[string]uintptr{
+	"amd64": 306, "386": 344, "arm64": 267, "arm": 373, "riscv64": 267,
+	"loong64": 267, "ppc64": 348, "ppc64le": 348, "s390x": 338,
+}[runtime.GOARCH]
+
+// reflink makes the `df` file share the contents of the `sf` file, without
+// copying them, with the FICLONE ioctl.
+// Returns an error if the file system does not support it.
+func reflink(df, sf *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, df.Fd(), ficlone(), sf.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// flushDir commits the copy in the `dir` directory to disk once it is in place,
+// at once, by syncing the file system holding it. Falls back to syncing the
+// directory and the directory holding it if the syncfs system call is unknown,
+// see syncDirs.
+func flushDir(dir string) error {
+	if sysSyncfs == 0 {
+		return syncDirs(dir)
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, _, errno := syscall.Syscall(sysSyncfs, f.Fd(), 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// errReflink is returned when reflinks are not supported on the platform.
+var errReflink = errors.New("reflinks not supported")
+
+// reflink is not supported on the platform, always returns errReflink.
+func reflink(df, sf *os.File) error {
+	return errReflink
+}
+
+// flushDir commits the copy in the `dir` directory to disk once it is in place,
+// by syncing the directory and the directory holding it, see syncDirs.
+func flushDir(dir string) error {
+	return syncDirs(dir)
+}
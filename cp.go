@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"go/build"
+	"go/parser"
 	"go/scanner"
 	"go/token"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -29,25 +34,24 @@ var ErrDstExists = errors.New("destination already exists")
 // or any of its child packages based on the `recurse` parameter.
 // Includes hidden files (staring with a dot) when copying files based on the
 // `hidden` parameter.
-func cp(ctx *build.Context, cwd, src, dst string, recurse, hidden bool) (err error) {
-	// Check if destination folder exists and based on force flag determine
-	// action.
-	if _, serr := os.Stat(dst); serr == nil {
-		if opt.force {
-			os.RemoveAll(dst)
-		} else {
-			return ErrDstExists
-		}
-	} else if !os.IsNotExist(serr) {
-		// Some other error with destination
-		return serr
-	}
-	var srcImp, dstImp string
-	var srcPkg, dstPkg *build.Package
-	// May fail because there is multiple packages in the folder but all
-	// that is necessary here is the directory and the import path.
-	// Can't use the build.MultiplePackageError, to detect the error because
-	// it was only added in 1.4, and we want 1.2+.
+// Strips canonical import paths from the copied files, with the opt.canonical
+// option set rewrites them to the new import path instead.
+// Validates the copy before making any changes, see checkCopy.
+// Records the digests of the copied files in the destination directory after
+// its import paths are updated, along with the revision of the Git or Mercurial
+// working copy the source is located in, if any.
+// With the opt.sync option set an existing destination is updated, only the
+// files that differ once the import paths are updated are copied and replace
+// the previous ones, see linkFiles and syncDir. Without the `hidden` parameter
+// set the hidden files of the destination that still exist in the source are
+// kept, see keepHidden.
+func cp(cctx context.Context, ctx *build.Context, cwd, src, dst string, recurse, hidden bool) (err error) {
+	var srcImp string
+	var srcPkg *build.Package
+	// May fail because there is multiple packages in the folder, or other
+	// errors that still return a partial package, but all that is necessary
+	// here is the directory and the import path, so check those instead of
+	// the error type.
 	if srcPkg, err = getPackage(ctx, cwd, src); len(srcPkg.Dir) == 0 {
 		if err == nil {
 			return fmt.Errorf("package has no directory")
@@ -63,37 +67,220 @@ func cp(ctx *build.Context, cwd, src, dst string, recurse, hidden bool) (err err
 	} else if dst, err = cwdAbs(cwd, dst); err != nil {
 		return err
 	}
-	// Copy the package over.
-	if err = copyDir(src, dst, hidden); err != nil {
+	// Validate before making any changes.
+	if p := checkCopy(ctx, cwd, srcImp, src, dst, recurse); len(p) > 0 {
+		return p
+	} else if err := checkDst(dst); err != nil {
+		return err
+	}
+	// Detect the revision of the source, so the copy can be traced back to
+	// it, not being able to read it does not prevent the copy.
+	vcs, verr := detectVCS(src)
+	if verr != nil {
+		fmt.Printf("could not read the revision of %s : %s\n", src, verr.Error())
+		vcs = nil
+	} else if vcs != nil && opt.verbose {
+		fmt.Printf("copying %s at %s\n", srcImp, vcs)
+	}
+	// Copy the package over, into a temporary directory that replaces the
+	// destination once it is ready.
+	tmp, err := tempDir(dst)
+	if err != nil {
 		return err
 	}
-	// Strip the canonical import path from files.
-	if err = stripCanonicalImportPathDir(dst); err != nil {
+	defer os.RemoveAll(tmp)
+	if err = copyDir(cctx, src, tmp, hidden, linkFiles(srcImp, src, dst)); err != nil {
+		return copyInterrupted(err, srcImp, dst)
+	}
+	r := &record{Origin: srcImp, Hidden: hidden, Canonical: opt.canonical,
+		Group: opt.group, VCS: vcs}
+	return finishCopy(cctx, ctx, cwd, src, tmp, dst, recurse, r)
+}
+
+// checkDst checks whether the destination directory of a copy exists, if so
+// returns ErrDstExists unless the opt.force or the opt.sync option is set, in
+// which case it is replaced once the copy is ready, see replaceDir and syncDir.
+func checkDst(dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		if !opt.force && !opt.sync {
+			return ErrDstExists
+		}
+	} else if !os.IsNotExist(err) {
+		// Some other error with destination
 		return err
 	}
+	return nil
+}
+
+// finishCopy processes the files copied from the `src` directory into the
+// `tmp` directory, of the package with the import path of the record's origin,
+// and swaps them into the `dst` directory, see replaceDir.
+// Updates the canonical import paths and the import paths of the copy, records
+// the copy with the passed record, and updates the import paths of the package
+// in the current working directory.
+// Syncs the destination to disk once it is replaced, see flushDir.
+// Recurses into subdirectories of the current working directory based on the
+// `recurse` parameter.
+// Once the `cctx` context is done nothing is changed until the copy replaces the
+// destination, then returns an errInterrupted from updating the import paths.
+func finishCopy(cctx context.Context, ctx *build.Context, cwd, src, tmp, dst string, recurse bool, r *record) error {
+	srcImp := r.Origin
 	// Determine import path of the new package, and update import paths in
 	// the current working directory.
 	// Update the import paths of the new package and its children.
-	if dstPkg, err = getPackage(ctx, cwd, dst); len(dstPkg.ImportPath) == 0 {
+	dstImp, err := getImportPath(ctx, cwd, dst)
+	if err != nil {
 		return err
+	}
+	// Strip the canonical import path from files, or rewrite it to the new
+	// import path with the opt.canonical option set.
+	if r.Canonical {
+		err = rwCanonicalImportPathDir(tmp, srcImp, dstImp)
 	} else {
-		dstImp = dstPkg.ImportPath
+		err = stripCanonicalImportPathDir(tmp)
+	}
+	if err != nil {
+		return err
 	}
 	// Update import paths in the copied package itself, as it may contain
 	// an external _test package that imports itself or may contain packages
 	// in its subdirectories that import it, must recurse.
-	if err := path(ctx, dst, srcImp, dstImp, true); err != nil {
+	if err := path(cctx, ctx, tmp, srcImp, dstImp, true); err != nil {
+		return copyInterrupted(err, srcImp, dst)
+	}
+	// Hidden files that are not copied are kept when only the differences
+	// replace the previous copy.
+	if opt.sync && !r.Hidden {
+		if err := keepHidden(cctx, src, tmp, dst); err != nil {
+			return copyInterrupted(err, srcImp, dst)
+		}
+	}
+	// Record the digests of the copied files, so later modifications can be
+	// detected.
+	if err := recordDir(tmp, src, r); err != nil {
+		return err
+	}
+	// With the opt.sync option set only the differences replace the
+	// previous copy.
+	if opt.sync {
+		if err := syncDir(src, tmp, dst); err != nil {
+			return err
+		}
+	}
+	if err := replaceDir(tmp, dst); err != nil {
+		return err
+	} else if err := flushDir(dst); err != nil {
 		return err
 	}
 	// Update the import paths, if the recurse flag is set recurse through
 	// the subdirectories and update import paths.
-	return path(ctx, cwd, srcImp, dstImp, recurse)
+	done := []string{fmt.Sprintf("copied %s to %s", srcImp, dst)}
+	return wrapInterrupted(path(cctx, ctx, cwd, srcImp, dstImp, recurse), done, nil)
+}
+
+// copyInterrupted replaces an errInterrupted returned while preparing the copy
+// of the package with the `srcImp` import path into the `dst` directory, as
+// nothing is done until the copy replaces the destination.
+func copyInterrupted(err error, srcImp, dst string) error {
+	if _, ok := err.(*errInterrupted); ok {
+		return &errInterrupted{pending: []string{fmt.Sprintf("copy %s to %s", srcImp, dst)}}
+	}
+	return err
+}
+
+// syncDir prepares the `tmp` directory, holding the copy that replaces the
+// `dst` directory once its import paths are rewritten, so the replacement only
+// changes the files that differ. Files that are not rewritten are already
+// linked to the identical files of the `dst` directory when copied, see
+// linkFiles. The rewritten files identical to the file at the same path in the
+// `dst` directory, compared by mode, size, and digest, are replaced with a link
+// to it, keeping its modification time, which is copied over instead where
+// linking fails unless the file is linked to the one in the `src` directory it
+// was copied from. Files no longer in the copy are removed by the replacement.
+// With the opt.verbose option set outputs the files that are added, updated, or
+// removed.
+func syncDir(src, tmp, dst string) error {
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	walk := func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(tmp, path)
+		if err != nil {
+			return err
+		}
+		seen[rel] = true
+		dstPath := filepath.Join(dst, rel)
+		di, err := os.Lstat(dstPath)
+		if err != nil || !di.Mode().IsRegular() {
+			if opt.verbose {
+				fmt.Printf("adding %s\n", dstPath)
+			}
+			return nil
+		} else if os.SameFile(info, di) {
+			return nil
+		}
+		if same, err := sameFile(path, info, dstPath, di); err != nil {
+			return err
+		} else if !same {
+			if opt.verbose {
+				fmt.Printf("updating %s\n", dstPath)
+			}
+			return nil
+		}
+		link := path + ".vend-link"
+		if err := os.Link(dstPath, link); err == nil {
+			return os.Rename(link, path)
+		}
+		// Changing the times of a file linked to the source would
+		// change the source.
+		if si, err := os.Lstat(filepath.Join(src, rel)); err == nil && os.SameFile(info, si) {
+			return nil
+		}
+		return os.Chtimes(path, di.ModTime(), di.ModTime())
+	}
+	if err := filepath.Walk(tmp, walk); err != nil || !opt.verbose {
+		return err
+	}
+	return filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		if rel, err := filepath.Rel(dst, path); err != nil {
+			return err
+		} else if !seen[rel] {
+			fmt.Printf("removing %s\n", path)
+		}
+		return nil
+	})
+}
+
+// sameFile checks whether the files at the `a` and `b` paths, described by the
+// `ai` and `bi` file infos, have the same mode, size, and digest.
+func sameFile(a string, ai os.FileInfo, b string, bi os.FileInfo) (bool, error) {
+	if ai.Mode() != bi.Mode() || ai.Size() != bi.Size() {
+		return false, nil
+	}
+	as, err := hashFile(a)
+	if err != nil {
+		return false, err
+	}
+	bs, err := hashFile(b)
+	if err != nil {
+		return false, err
+	}
+	return as == bs, nil
 }
 
 // copyFileJob holds a pending copyFile call.
 type copyFileJob struct {
-	si       os.FileInfo
-	src, dst string
+	si             os.FileInfo
+	src, dst, link string
 }
 
 // copyDir recursively copies the src directory to the desination directory.
@@ -102,7 +289,12 @@ type copyFileJob struct {
 // With the opt.verbose option set outputs the src and destination of each
 // copied file.
 // Skips hidden files base on the `hidden` parameter.
-func copyDir(src, dst string, hidden bool) error {
+// Copies files as set by the opt.copyMode option, see copyFile, the `link`
+// function, when not nil, returns the path of the file to link each file to
+// instead, empty to copy it.
+// Stops before copying the next file once the `cctx` context is done,
+// returning an errInterrupted.
+func copyDir(cctx context.Context, src, dst string, hidden bool, link func(path string, info os.FileInfo) (string, error)) error {
 	// First compile a list of copies to execute then execute, otherwise
 	// infinite copy situations could arise when copying a parent directory
 	// into a child directory.
@@ -130,15 +322,165 @@ func copyDir(src, dst string, hidden bool) error {
 			printBold(path)
 			fmt.Println(fileDst)
 		}
-		cjs = append(cjs, copyFileJob{info, path, fileDst})
+		var to string
+		if link != nil && info.Mode().IsRegular() {
+			if to, err = link(path, info); err != nil {
+				return err
+			}
+		}
+		cjs = append(cjs, copyFileJob{info, path, fileDst, to})
 		return nil
 	}
 	if err := filepath.Walk(src, walk); err != nil {
 		return err
 	}
 	// Execute copies
-	for _, cj := range cjs {
-		if err := copyFile(cj.si, cj.src, cj.dst); err != nil {
+	for i, cj := range cjs {
+		if cctx.Err() != nil {
+			ie := &errInterrupted{}
+			for _, cj := range cjs[:i] {
+				ie.done = append(ie.done, "copied "+cj.dst)
+			}
+			for _, cj := range cjs[i:] {
+				ie.pending = append(ie.pending, "copy "+cj.dst)
+			}
+			return ie
+		}
+		if err := copyFile(cj.si, cj.src, cj.dst, cj.link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkFiles returns the function passed to copyDir deciding which of the files
+// copied from the `src` directory, of the package with the `srcImp` import
+// path, are linked rather than copied. Only the files that are not rewritten
+// once copied are linked, see rewrittenFile.
+// With the opt.sync option set those identical to the file at the same path in
+// the `dst` directory, compared by mode, size, and digest, are linked to it, so
+// only the files that differ are copied, see syncDir. With the opt.copyMode
+// option set to hardlink the others are linked to the source.
+// Returns nil when no file is linked.
+func linkFiles(srcImp, src, dst string) func(path string, info os.FileInfo) (string, error) {
+	hardlink := opt.copyMode == "hardlink"
+	if !hardlink && !opt.sync {
+		return nil
+	}
+	return func(path string, info os.FileInfo) (string, error) {
+		if rw, err := rewrittenFile(path, srcImp); err != nil || rw {
+			return "", err
+		}
+		if opt.sync {
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return "", err
+			}
+			dstPath := filepath.Join(dst, rel)
+			if di, err := os.Lstat(dstPath); err == nil && di.Mode().IsRegular() {
+				if same, err := sameFile(path, info, dstPath, di); err != nil {
+					return "", err
+				} else if same {
+					return dstPath, nil
+				}
+			}
+		}
+		if hardlink {
+			return path, nil
+		}
+		return "", nil
+	}
+}
+
+// keepHidden links the hidden files and directories of the `dst` directory,
+// which still exist in the `src` directory, into the `tmp` directory holding
+// the copy made without hidden files that replaces it. The record of the copy
+// is not kept, as it is replaced.
+// Returns an errInterrupted once the `cctx` context is done, see copyDir.
+func keepHidden(cctx context.Context, src, tmp, dst string) error {
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	linkSelf := func(path string, _ os.FileInfo) (string, error) {
+		return path, nil
+	}
+	walk := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dst || !strings.HasPrefix(info.Name(), ".") ||
+			info.Name() == recordName {
+			return nil
+		}
+		rel, err := filepath.Rel(dst, path)
+		if err != nil {
+			return err
+		}
+		// Skip those no longer upstream, or whose directory no longer is.
+		if _, err := os.Lstat(filepath.Join(src, rel)); os.IsNotExist(err) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := copyDir(cctx, path, filepath.Join(tmp, rel), true, linkSelf); err != nil {
+			return err
+		} else if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	return filepath.Walk(dst, walk)
+}
+
+// rewrittenFile checks whether the file at the `path`, copied from the package
+// with the `srcImp` import path, is rewritten once copied, see finishCopy.
+// Those are the Go files holding a canonical import path, or importing the
+// package or one of its child packages, as well as those that cannot be parsed.
+func rewrittenFile(path, srcImp string) (bool, error) {
+	if !strings.HasSuffix(filepath.Base(path), ".go") {
+		return false, nil
+	}
+	src, err := getFileContents(path)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := findCanonicalImportPath(src); ok {
+		return true, nil
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), path, src, parser.ImportsOnly)
+	if err != nil {
+		return true, nil
+	}
+	for _, is := range f.Imports {
+		if isImportIn(srcImp, specPath(is)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// syncDirs commits the `dir` directory and the directory holding it to disk,
+// so their entries are in place. Directories are left to the operating system
+// on Windows, where they cannot be synced.
+func syncDirs(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		f, err := os.Open(d)
+		if err != nil {
+			return err
+		}
+		err = f.Sync()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -149,14 +491,23 @@ func copyDir(src, dst string, hidden bool) error {
 // devices, and etc.
 var ErrIrregularFile = errors.New("non regular file")
 
+// copyModes lists the valid values of the opt.copyMode option.
+var copyModes = []string{"copy", "hardlink", "reflink"}
+
 // copyFile copies a file or directory from src to dst. Creates directories as
 // necessary. Attempts to chmod to the src mode. Returns an error if the file
 // is src file is irregular, i.e. link, pipe, or device.
-func copyFile(si os.FileInfo, src, dst string) (err error) {
+// With the `link` path set links the file to it instead, see linkFiles. With
+// the opt.copyMode option set to reflink shares the contents of files where the
+// file system supports it. Falls back to copying the contents.
+func copyFile(si os.FileInfo, src, dst, link string) (err error) {
 	switch {
 	case si.Mode().IsDir():
 		return os.MkdirAll(dst, si.Mode())
 	case si.Mode().IsRegular():
+		if len(link) > 0 && os.Link(link, dst) == nil {
+			return nil
+		}
 		closeErr := func(f *os.File) {
 			// Properly return a close error
 			if cerr := f.Close(); err == nil {
@@ -173,10 +524,10 @@ func copyFile(si os.FileInfo, src, dst string) (err error) {
 			return err
 		}
 		defer closeErr(df)
-		// Copy contents
-		if _, err = io.Copy(df, sf); err != nil {
-			return err
-		} else if err = df.Sync(); err != nil {
+		// Copy contents, synced to disk by finishCopy.
+		if opt.copyMode == "reflink" && reflink(df, sf) == nil {
+			return df.Chmod(si.Mode())
+		} else if _, err = io.Copy(df, sf); err != nil {
 			return err
 		} else {
 			return df.Chmod(si.Mode())
@@ -189,6 +540,21 @@ func copyFile(si os.FileInfo, src, dst string) (err error) {
 // stripCanonicalImportPathDir strips the canonical import path from all files
 // in the directory.
 func stripCanonicalImportPathDir(dir string) error {
+	return canonicalImportPathDir(dir, "", "", false)
+}
+
+// rwCanonicalImportPathDir rewrites the canonical import path in all the files
+// in the directory from the `from` import path, or one of its child packages,
+// to the equivalent in the `to` import path. Canonical import paths that are
+// not located in the `from` import path are stripped.
+func rwCanonicalImportPathDir(dir, from, to string) error {
+	return canonicalImportPathDir(dir, from, to, true)
+}
+
+// canonicalImportPathDir strips or rewrites the canonical import path in all
+// the files in the directory, based on the `rewrite` parameter, see
+// rwCanonicalImportPath.
+func canonicalImportPathDir(dir, from, to string, rewrite bool) error {
 	walk := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -197,25 +563,49 @@ func stripCanonicalImportPathDir(dir string) error {
 			!strings.HasSuffix(filepath.Base(path), ".go") {
 			return nil
 		}
-		return stripCanonicalImportPathFile(path)
+		src, err := getFileContents(path)
+		if err != nil {
+			return err
+		}
+		out, changed, err := rwCanonicalImportPath(src, from, to, rewrite)
+		if err != nil || !changed {
+			return err
+		}
+		return writeFile(path, out, 0644)
 	}
 	return filepath.Walk(dir, walk)
 }
 
-// stripCanonicalImportPathFile strips the canonical import path from the file
-// at the path.
-func stripCanonicalImportPathFile(path string) error {
-	src, err := getFileContents(path)
-	if err != nil {
-		return err
+// rwCanonicalImportPath strips the canonical import path from the src, or when
+// the `rewrite` parameter is set rewrites it from the `from` import path, or one
+// of its child packages, to the equivalent in the `to` import path keeping the
+// style of the comment. Canonical import paths that are not located in the
+// `from` import path are always stripped.
+// Returns the resulting source and whether it was changed.
+func rwCanonicalImportPath(src []byte, from, to string, rewrite bool) ([]byte, bool, error) {
+	ci, ok := findCanonicalImportPath(src)
+	if !ok {
+		return src, false, nil // nothing to do
 	}
-	contains, start, end := containsCanonicalImportPath(src)
-	if !contains {
-		return nil // nothing to do
+	out := make([]byte, 0, len(src))
+	if rewrite && isImportIn(from, ci.path) {
+		np := to
+		if ci.path != from {
+			var err error
+			if np, err = changeImportPath(from, to, ci.path); err != nil {
+				return nil, false, err
+			}
+		}
+		comment := "// import " + strconv.Quote(np)
+		if ci.block {
+			comment = "/* import " + strconv.Quote(np) + " */"
+		}
+		out = append(out, src[:ci.start]...)
+		out = append(out, comment...)
+	} else {
+		out = append(out, src[:ci.identEnd]...)
 	}
-	// Strip the path and write to the file.
-	strip := append(src[:start], src[end:]...)
-	return ioutil.WriteFile(path, strip, 0)
+	return append(out, src[ci.end:]...), true, nil
 }
 
 // containsCanonicalImportPath check whether the src contains a canonical
@@ -223,43 +613,117 @@ func stripCanonicalImportPathFile(path string) error {
 // declaration ends to where the comment ends.
 // Offset start at 0.
 func containsCanonicalImportPath(src []byte) (contains bool, start, end int) {
+	ci, ok := findCanonicalImportPath(src)
+	return ok, ci.identEnd, ci.end
+}
+
+// canonicalImport holds the location of a canonical import path comment.
+type canonicalImport struct {
+	// path is the import path specified by the comment.
+	path string
+	// block is whether the comment is a general comment, /* */, instead of
+	// a line comment.
+	block bool
+	// identEnd is the offset where the package name ends.
+	identEnd int
+	// start and end are the offsets where the comment starts and ends.
+	start, end int
+}
+
+// canonicalImportComment matches the text of a canonical import path comment,
+// with the comment markers removed.
+var canonicalImportComment = regexp.MustCompile("^\\s*import\\s+(\"[^\"\\n]*\"|`[^`]*`)\\s*$")
+
+// findCanonicalImportPath finds the canonical import path comment in the src,
+// the comment must be placed on the same line as the package clause directly
+// after the package name, other tokens may follow it.
+// Both the line comment, // import "path", and the general comment,
+// /* import "path" */, forms are matched.
+func findCanonicalImportPath(src []byte) (ci canonicalImport, ok bool) {
 	fs := token.NewFileSet()
 	tf := fs.AddFile("", fs.Base(), len(src))
 	var s scanner.Scanner
 	s.Init(tf, src, nil, scanner.ScanComments)
-	currentLine := 0
-	type scanned struct {
-		pos token.Position
-		tok token.Token
-		lit string
+	// Find the package clause skipping any leading comments.
+	scan := func() (token.Position, token.Token, string) {
+		for {
+			pos, tok, lit := s.Scan()
+			if tok != token.COMMENT {
+				return fs.Position(pos), tok, lit
+			}
+		}
+	}
+	if _, tok, _ := scan(); tok != token.PACKAGE {
+		return ci, false
+	}
+	identPos, tok, lit := scan()
+	if tok != token.IDENT {
+		return ci, false
 	}
-	var line []scanned // current line buffer
+	ci.identEnd = identPos.Offset + len(lit)
+	// The comment must be the next token on the same line, some versions of
+	// the scanner place an automatic semicolon before it.
 	for {
 		pos, tok, lit := s.Scan()
 		posd := fs.Position(pos)
-		if tok == token.EOF || posd.Line != currentLine {
-			// Does it match the signature of the canonical import
-			// path comment, which will be preceded by a PACKAGE,
-			// IDENT, and SEMICOLON.
-			if len(line) == 4 &&
-				line[0].tok == token.PACKAGE &&
-				line[1].tok == token.IDENT &&
-				line[2].tok == token.SEMICOLON &&
-				line[3].tok == token.COMMENT {
-				return true,
-					line[1].pos.Offset + len(line[1].lit),
-					line[3].pos.Offset + len(line[3].lit)
-			}
-			// Reset the current line.
-			line = make([]scanned, 0, 0)
-			currentLine = posd.Line
+		switch {
+		case tok == token.SEMICOLON && lit == "\n":
+			continue
+		case tok != token.COMMENT || posd.Line != identPos.Line:
+			return ci, false
+		}
+		var text string
+		if strings.HasPrefix(lit, "/*") {
+			ci.block = true
+			text = strings.TrimSuffix(strings.TrimPrefix(lit, "/*"), "*/")
+		} else {
+			text = strings.TrimPrefix(lit, "//")
 		}
-		line = append(line, scanned{posd, tok, lit})
-		if tok == token.EOF {
-			break
+		m := canonicalImportComment.FindStringSubmatch(text)
+		if m == nil {
+			return ci, false
 		}
+		path, err := strconv.Unquote(m[1])
+		if err != nil {
+			return ci, false
+		}
+		ci.path = path
+		ci.start, ci.end = posd.Offset, posd.Offset+len(lit)
+		return ci, true
+	}
+}
+
+// cpTransform applies the changes cp makes to a copied Go source file to its
+// contents without writing them. Strips the canonical import path, or rewrites
+// it based on the `canonical` parameter, and rewrites the imports of the
+// copied package, `from`, and of its child packages to their equivalent in the
+// `to` import path with the passed rewriter. The name is used to report
+// errors.
+func cpTransform(name string, src []byte, from, to string, canonical bool, r *rewriter) ([]byte, error) {
+	src, _, err := rwCanonicalImportPath(src, from, to, canonical)
+	if err != nil {
+		return nil, err
+	}
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, name, src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	imps := make([]string, 0, len(f.Imports))
+	for _, is := range f.Imports {
+		imp, err := strconv.Unquote(is.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		imps = append(imps, imp)
+	}
+	rw, err := rwImportPaths(imps, from, to)
+	if err != nil {
+		return nil, err
+	} else if len(rw) == 0 {
+		return src, nil
 	}
-	return false, 0, 0
+	return r.withPaths(rw).rwSrc(name, src)
 }
 
 // getFileContens opens the file at the provided path, reads all the content,
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 // TestCp tests the cp subcommand checking that imports are updated in the
@@ -14,7 +17,7 @@ func TestCp(t *testing.T) {
 	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
-	err := cp(ctx, pkgDir, filepath.Join("other.com", "y"),
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"),
 		filepath.Join("lib", "y"), false, false)
 	if err != nil {
 		t.Fatalf("error during cp : %s", err.Error())
@@ -35,7 +38,7 @@ func TestCpRecursive(t *testing.T) {
 	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
-	err := cp(ctx, pkgDir, filepath.Join("other.com", "y"),
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"),
 		filepath.Join("lib", "y"), true, false)
 	if err != nil {
 		t.Errorf("error during cp : %s", err.Error())
@@ -47,21 +50,19 @@ func TestCpRecursive(t *testing.T) {
 }
 
 // TestCpInfinite test calling the cp command to copy a package into its own
-// subdirectory, it should not cause an infinite process where it copies copies
-// of copies.
+// subdirectory, it is refused before making any changes, as it would copy
+// copies of copies.
 func TestCpInfinite(t *testing.T) {
 	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
 	cpPkgDir := filepath.Join(ctx.GOPATH, "src", "other.com", "y", "lib", "y")
-	err := cp(ctx, pkgDir, filepath.Join("other.com", "y"), cpPkgDir, false, false)
-	if err != nil {
-		t.Errorf("error during cp : %s", err.Error())
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"), cpPkgDir, false, false)
+	if _, ok := err.(errPreflight); !ok {
+		t.Errorf("expected a preflight error, got %v", err)
 	}
-	testImports(t, pkgDir, []string{"other.com/y/lib/y"}, false)
-	// Test that the import path updated in the external test package of the
-	// copied package.
-	testImports(t, cpPkgDir, []string{"other.com/y/lib/y"}, true)
+	testExists(t, cpPkgDir, false)
+	testImports(t, pkgDir, []string{"other.com/y"}, false)
 }
 
 // TestCpStripCanonicalImportPaths tests that the cannonical import paths are
@@ -74,7 +75,7 @@ func TestCpStripCanonicalImportPaths(t *testing.T) {
 	//defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
 	dstDir := filepath.Join(pkgDir, "lib", "y")
-	err := cp(ctx, pkgDir, filepath.Join("other.com", "y"),
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"),
 		dstDir, false, false)
 	if err != nil {
 		t.Fatalf("error during cp : %s", err.Error())
@@ -124,7 +125,7 @@ func testHiddenFiles(t *testing.T, keepHidden bool) {
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
 	dstPkgDir := filepath.Join(pkgDir, "lib", "y")
-	err := cp(ctx, pkgDir, filepath.Join("other.com", "y"),
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"),
 		filepath.Join("lib", "y"), false, keepHidden)
 	if err != nil {
 		t.Errorf("error during cp : %s", err.Error())
@@ -153,3 +154,236 @@ func testExists(t *testing.T, path string, exists bool) {
 		}
 	}
 }
+
+// rwCanonicalImportPathTests holds table tests for the rwCanonicalImportPath
+// function.
+var rwCanonicalImportPathTests = []struct {
+	src     string
+	rewrite bool
+	out     string
+}{
+	{
+		"package y // import \"other.com/y\"\n",
+		false,
+		"package y\n",
+	},
+	{
+		"package y // import \"other.com/y\"\n",
+		true,
+		"package y // import \"example.com/x/lib/y\"\n",
+	},
+	{
+		"// Package doc.\npackage sub /* import \"other.com/y/sub\" */\n",
+		true,
+		"// Package doc.\npackage sub /* import \"example.com/x/lib/y/sub\" */\n",
+	},
+	{
+		"package y /* import \"other.com/y\" */; const A = 1\n",
+		false,
+		"package y; const A = 1\n",
+	},
+	{
+		"package y /* import \"other.com/y\" */; const A = 1\n",
+		true,
+		"package y /* import \"example.com/x/lib/y\" */; const A = 1\n",
+	},
+	{
+		// Not located in the copied package, always stripped.
+		"package y // import \"another.com/y\"\n",
+		true,
+		"package y\n",
+	},
+	{
+		// Not a canonical import path comment.
+		"package y // nothing to see here\n",
+		false,
+		"package y // nothing to see here\n",
+	},
+	{
+		// Comment not directly after the package name.
+		"package y; // import \"other.com/y\"\n",
+		false,
+		"package y; // import \"other.com/y\"\n",
+	},
+}
+
+// TestRwCanonicalImportPath tests stripping and rewriting canonical import
+// paths in the different forms of the comment.
+func TestRwCanonicalImportPath(t *testing.T) {
+	for _, tt := range rwCanonicalImportPathTests {
+		out, _, err := rwCanonicalImportPath([]byte(tt.src),
+			"other.com/y", "example.com/x/lib/y", tt.rewrite)
+		if err != nil {
+			t.Errorf("error processing %q : %s", tt.src, err.Error())
+		} else if string(out) != tt.out {
+			t.Errorf("processing %q : got %q, expected %q", tt.src, out, tt.out)
+		}
+	}
+}
+
+// TestCpRewriteCanonicalImportPaths tests that the canonical import paths are
+// rewritten to the new import path in the main copied package and in a copied
+// child package when the canonical option is set.
+func TestCpRewriteCanonicalImportPaths(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func() { opt.canonical = false }()
+	opt.canonical = true
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"), dstDir, false, false)
+	if err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	testCanonicalImportPath(t, filepath.Join(dstDir, "y.go"),
+		"example.com/x/lib/y")
+	testCanonicalImportPath(t, filepath.Join(dstDir, "sub", "sub.go"),
+		"example.com/x/lib/y/sub")
+}
+
+// testCanonicalImportPath tests that the file contains the expected canonical
+// import path.
+func testCanonicalImportPath(t *testing.T, path, expected string) {
+	src, err := getFileContents(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci, ok := findCanonicalImportPath(src); !ok {
+		t.Errorf("canonical import path not found in file %s", path)
+	} else if ci.path != expected {
+		t.Errorf("canonical import path in file %s : got %s, expected %s",
+			path, ci.path, expected)
+	}
+}
+
+// TestCpSync tests that copying over an existing copy with the sync option
+// replaces only the files that differ, once import paths are updated, keeping
+// the others, and hidden files that still exist in the source, and removes
+// files no longer in the source.
+func TestCpSync(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func() { opt.sync = false }()
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	srcDir := filepath.Join(ctx.GOPATH, "src", "other.com", "y")
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	plain := []byte("package y\n\nconst Plain = 1\n")
+	if err := ioutil.WriteFile(filepath.Join(srcDir, "plain.go"), plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, false); err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	plainInfo, err := os.Stat(filepath.Join(dstDir, "plain.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hidden files are kept as long as they exist upstream.
+	for _, f := range []string{".hidden", ".gone"} {
+		if err := ioutil.WriteFile(filepath.Join(dstDir, f), []byte("kept\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Age the copy, change a source file, and add a file to the copy.
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, f := range []string{"y.go", "y_test.go", filepath.Join("sub", "sub.go")} {
+		if err := os.Chtimes(filepath.Join(dstDir, f), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changed := filepath.Join(srcDir, "sub", "sub.go")
+	if f, err := os.OpenFile(changed, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		t.Fatal(err)
+	} else {
+		f.WriteString("\n// changed upstream\n")
+		f.Close()
+	}
+	extra := filepath.Join(dstDir, "extra.go")
+	if err := ioutil.WriteFile(extra, []byte("package y\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt.sync = true
+	if err := cp(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, false); err != nil {
+		t.Fatalf("error during cp with sync : %s", err.Error())
+	}
+	// The external test package differs from its source, it imports the copy.
+	for _, f := range []string{"y.go", "y_test.go"} {
+		if info, err := os.Stat(filepath.Join(dstDir, f)); err != nil {
+			t.Fatal(err)
+		} else if !info.ModTime().Equal(old) {
+			t.Errorf("expected %s to be untouched, modified at %s", f, info.ModTime())
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dstDir, "sub", "sub.go")); err != nil {
+		t.Fatal(err)
+	} else if info.ModTime().Equal(old) {
+		t.Errorf("expected sub.go to be updated")
+	}
+	// Files that are not rewritten are compared before being copied.
+	if info, err := os.Stat(filepath.Join(dstDir, "plain.go")); err != nil {
+		t.Fatal(err)
+	} else if !os.SameFile(info, plainInfo) {
+		t.Errorf("expected plain.go to be kept rather than copied")
+	}
+	if got, err := getFileContents(filepath.Join(dstDir, ".hidden")); err != nil {
+		t.Errorf("expected .hidden to be kept : %s", err.Error())
+	} else if string(got) != "kept\n" {
+		t.Errorf("expected .hidden to be kept as is, got %q", got)
+	}
+	testExists(t, filepath.Join(dstDir, ".gone"), false)
+	testExists(t, extra, false)
+	testImports(t, dstDir, []string{"example.com/x/lib/y"}, true)
+	if err := verify(pkgDir, dstDir); err != nil {
+		t.Errorf("expected the record to be updated : %s", err.Error())
+	}
+}
+
+// TestCpCopyModes tests copying with the hardlink and reflink copy modes, that
+// files which are not rewritten are linked to the source with the hardlink copy
+// mode, that files that are rewritten are not, and that the source is left
+// unchanged.
+func TestCpCopyModes(t *testing.T) {
+	defer func(m string) { opt.copyMode = m }(opt.copyMode)
+	for _, mode := range []string{"hardlink", "reflink"} {
+		ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+		defer os.RemoveAll(ctx.GOPATH)
+		pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+		srcDir := filepath.Join(ctx.GOPATH, "src", "other.com", "y")
+		dstDir := filepath.Join(pkgDir, "lib", "y")
+		plain := []byte("package y\n\nconst Plain = 1\n")
+		if err := ioutil.WriteFile(filepath.Join(srcDir, "plain.go"), plain, 0644); err != nil {
+			t.Fatal(err)
+		}
+		opt.copyMode = mode
+		if err := cp(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, true); err != nil {
+			t.Fatalf("error during cp with %s copy mode : %s", mode, err.Error())
+		}
+		testImports(t, dstDir, []string{"example.com/x/lib/y"}, true)
+		testImports(t, srcDir, []string{"other.com/y"}, true)
+		// Go files have their canonical import paths stripped, or import
+		// the copied package.
+		for f, linked := range map[string]bool{
+			".hidden": true, "plain.go": true, "y.go": false, "y_test.go": false,
+		} {
+			si, err := os.Stat(filepath.Join(srcDir, f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			di, err := os.Stat(filepath.Join(dstDir, f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := os.SameFile(si, di); same != (linked && mode == "hardlink") {
+				t.Errorf("%s copy mode, %s linked to the source : %t", mode, f, same)
+			}
+		}
+	}
+	opt.copyMode = "symlink"
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	err := cp(context.Background(), ctx, pkgDir, "other.com/y", filepath.Join("lib", "y"), false, false)
+	if _, ok := err.(errPreflight); !ok {
+		t.Errorf("expected a preflight error for an invalid copy mode, got %v", err)
+	}
+}
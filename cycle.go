@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"sort"
+	"strings"
+)
+
+// errCycle is returned when an operation would introduce an import cycle, holds
+// the import paths along the cycle, starting and ending with the same package.
+type errCycle []string
+
+func (c errCycle) Error() string {
+	return fmt.Sprintf("import cycle : %s", strings.Join(c, " -> "))
+}
+
+// checkCycle checks whether rewriting the imports of the `from` import path to
+// the `to` import path introduces an import cycle, see predictCycle.
+// Returns the errCycle, with the opt.allowCycles option set only prints it.
+func checkCycle(ctx *build.Context, cwd, from, to string, recurse, copied, moved bool) error {
+	cycle, err := predictCycle(ctx, cwd, from, to, recurse, copied, moved)
+	if err != nil || cycle == nil {
+		return err
+	} else if opt.allowCycles {
+		fmt.Printf("warning, %s\n", cycle.Error())
+		return nil
+	}
+	return cycle
+}
+
+// predictCycle predicts whether updating the imports of the `from` import path,
+// and of its child packages, to their equivalent in the `to` import path in the
+// package in the `cwd` directory, or in all the packages located in its
+// subdirectories if `recurse`, introduces an import cycle, as done by path.
+// With `copied` the packages are also copied, as done by cp, in which case
+// `from` and `to` are the source and destination paths resolved from the `cwd`
+// directory. With `moved` the copied packages are also removed from the
+// source, as done by mv.
+// Compiles the import graph of the packages located in the `cwd` directory, and
+// their dependencies, before and after the change. Imports only made by test
+// files are ignored, as external test packages can import the package they
+// test.
+// Returns the shortest cycle through a changed package that was not already in
+// a cycle, nil if there is none or the paths cannot be resolved.
+func predictCycle(ctx *build.Context, cwd, from, to string, recurse, copied, moved bool) (errCycle, error) {
+	var srcDir string
+	if copied {
+		srcPkg, _ := getPackage(ctx, cwd, from)
+		if len(srcPkg.ImportPath) == 0 || len(srcPkg.Dir) == 0 {
+			return nil, nil
+		}
+		dst, err := cwdAbs(cwd, to)
+		if err != nil {
+			return nil, nil
+		}
+		if to, err = getImportPath(ctx, cwd, dst); err != nil {
+			return nil, nil
+		}
+		from, srcDir = srcPkg.ImportPath, srcPkg.Dir
+	}
+	cwdImp, err := getImportPath(ctx, cwd, cwd)
+	if err != nil {
+		return nil, err
+	}
+	// Gather the packages of the project, and the copied packages.
+	roots := make([]*build.Package, 0)
+	collect := func(pkg *build.Package, _ error) error {
+		if len(pkg.ImportPath) > 0 && len(pkg.Name) > 0 {
+			roots = append(roots, pkg)
+		}
+		return nil
+	}
+	if err := recursePackages(context.Background(), ctx, cwd, collect); err != nil {
+		return nil, err
+	}
+	if copied && !isChildDir(cwd, srcDir) {
+		if err := recursePackages(context.Background(), ctx, srcDir, collect); err != nil {
+			return nil, err
+		}
+	}
+	// Packages whose imports are updated.
+	scope := func(imp string) bool {
+		if recurse {
+			return isImportIn(cwdImp, imp)
+		}
+		return imp == cwdImp
+	}
+	rw := func(imp string) string {
+		if isImportIn(from, imp) {
+			return to + strings.TrimPrefix(imp, from)
+		}
+		return imp
+	}
+	pre := buildImportGraph(ctx, cwd, roots, false).withoutTests()
+	post := make(importGraph)
+	changed := make([]string, 0)
+	for p, edges := range pre {
+		if !scope(p) {
+			post[p] = edges
+			continue
+		}
+		post[p] = edges.rewrite(rw)
+		if !sameEdges(edges, post[p]) {
+			changed = append(changed, p)
+		}
+	}
+	// Copies replace the packages at their destination, their imports of
+	// the copied packages are updated. Moved packages no longer exist at
+	// the source.
+	if copied {
+		for p, edges := range pre {
+			if isImportIn(from, p) {
+				if moved {
+					delete(post, p)
+				}
+				post[rw(p)] = edges.rewrite(rw)
+				changed = appendUnique(changed, rw(p))
+			}
+		}
+	}
+	sort.Strings(changed)
+	for _, p := range changed {
+		if pre.cycle(p) != nil {
+			continue // already in a cycle
+		}
+		if cycle := post.cycle(p); cycle != nil {
+			return cycle, nil
+		}
+	}
+	return nil, nil
+}
+
+// withoutTests returns a copy of the graph without the imports only made by
+// test files.
+func (g importGraph) withoutTests() importGraph {
+	c := make(importGraph)
+	for p, edges := range g {
+		c[p] = make(importEdges, 0, len(edges))
+		for _, e := range edges {
+			if !e.test {
+				c[p] = append(c[p], e)
+			}
+		}
+	}
+	return c
+}
+
+// cycle finds the shortest cycle of imports through the package at the import
+// `path`. Returns nil if there is none.
+func (g importGraph) cycle(path string) errCycle {
+	next := make([]string, 0, len(g[path]))
+	for _, e := range g[path] {
+		next = append(next, e.path)
+	}
+	chain := g.shortestChain(next, path)
+	if chain == nil {
+		return nil
+	}
+	cycle := errCycle{path}
+	for _, e := range chain {
+		cycle = append(cycle, e.path)
+	}
+	return cycle
+}
+
+// rewrite returns a copy of the edges with the import paths passed through
+// the `rw` function, dropping duplicates.
+func (edges importEdges) rewrite(rw func(imp string) string) importEdges {
+	c := make(importEdges, 0, len(edges))
+	seen := make(map[string]bool)
+	for _, e := range edges {
+		if e.path = rw(e.path); !seen[e.path] {
+			seen[e.path] = true
+			c = append(c, e)
+		}
+	}
+	return c
+}
+
+// sameEdges checks whether both slices hold the same edges in the same order.
+func sameEdges(a, b importEdges) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestPredictCycle tests predicting the import cycles introduced by updating
+// and copying packages, ignoring imports made by test files.
+func TestPredictCycle(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cycle"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func(allowCycles bool) {
+		opt.allowCycles = allowCycles
+	}(opt.allowCycles)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	tests := []struct {
+		from, to        string
+		recurse, copied bool
+		expected        errCycle
+	}{
+		{"other.com/d", "example.com/x/b", true, false,
+			errCycle{"example.com/x/c", "example.com/x/b", "example.com/x/c"}},
+		{"other.com/d", "example.com/x", true, false,
+			errCycle{"example.com/x/c", "example.com/x", "example.com/x/b", "example.com/x/c"}},
+		{"other.com/d", "example.com/x/b", false, false, nil},
+		{"other.com/d", "other.com/e", true, false, nil},
+		{"other.com/d", filepath.Join("lib", "d"), true, true, nil},
+		{filepath.Join(pkgDir, "b"), filepath.Join("c", "b"), true, true, nil},
+	}
+	for _, tt := range tests {
+		cycle, err := predictCycle(ctx, pkgDir, tt.from, tt.to, tt.recurse, tt.copied, false)
+		if err != nil {
+			t.Errorf("%s to %s : %s", tt.from, tt.to, err.Error())
+		} else if !reflect.DeepEqual(cycle, tt.expected) {
+			t.Errorf("%s to %s : got cycle %v, expected %v", tt.from, tt.to, cycle, tt.expected)
+		}
+	}
+	if err := checkCycle(ctx, pkgDir, "other.com/d", "example.com/x/b", true, false, false); err == nil {
+		t.Errorf("expected a cycle error")
+	}
+	opt.allowCycles = true
+	if err := checkCycle(ctx, pkgDir, "other.com/d", "example.com/x/b", true, false, false); err != nil {
+		t.Errorf("expected only a warning, got %s", err.Error())
+	}
+}
+
+// TestPredictCycleMoved tests that moved packages are no longer part of the
+// import graph once moved, while copied ones are.
+func TestPredictCycleMoved(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cycle"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	// The m package is imported by a dependency it imports.
+	for rel, src := range map[string]string{
+		"example.com/x/m/m.go":   "package m\n\nimport _ \"example.com/x/m/a\"\n",
+		"example.com/x/m/a/a.go": "package a\n\nimport _ \"other.com/w\"\n",
+		"other.com/w/w.go":       "package w\n\nimport _ \"example.com/x/m\"\n",
+	} {
+		path := filepath.Join(ctx.GOPATH, "src", filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	from, to := filepath.Join(pkgDir, "m"), filepath.Join("lib", "m")
+	expected := errCycle{"example.com/x/lib/m/a", "other.com/w", "example.com/x/m", "example.com/x/lib/m/a"}
+	if cycle, err := predictCycle(ctx, pkgDir, from, to, true, true, false); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(cycle, expected) {
+		t.Errorf("copied : got cycle %v, expected %v", cycle, expected)
+	}
+	if cycle, err := predictCycle(ctx, pkgDir, from, to, true, true, true); err != nil {
+		t.Fatal(err)
+	} else if cycle != nil {
+		t.Errorf("moved : got cycle %v, expected none", cycle)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// diff runs the diff subcommand, outputs a unified diff from the upstream
+// package to its copy located in the `dir` directory.
+// The upstream package is resolved from the `upstream` path relative to the
+// current working directory or through the GOPATH, if empty the origin import
+// path recorded in the copy is used, or for copies made by get the repository
+// and the revision recorded, see exportRecord.
+// The changes made by cp are applied to the upstream files before comparing,
+// so only the local modifications to the copy are output.
+func diff(ctx *build.Context, cwd, dir, upstream string) error {
+	_, err := diffPackage(ctx, cwd, dir, upstream, os.Stdout)
+	return err
+}
+
+// diffPackage writes a unified diff from the upstream package to its copy
+// located in the `dir` directory to the writer, see diff.
+// Returns whether any differences were found.
+func diffPackage(ctx *build.Context, cwd, dir, upstream string, w io.Writer) (found bool, err error) {
+	if dir, err = cwdAbs(cwd, dir); err != nil {
+		return false, err
+	}
+	dstImp, err := getImportPath(ctx, cwd, dir)
+	if err != nil {
+		return false, err
+	}
+	// Use the record for defaults, if present.
+	canonical, regroup, hidden := opt.canonical, opt.group, opt.hidden
+	var srcDir, srcImp string
+	if r, err := readRecord(dir); err == nil {
+		canonical, regroup, hidden = r.Canonical, r.Group, r.Hidden
+		if len(upstream) == 0 {
+			upstream = r.Origin
+			if srcDir, err = exportRecord(r); err != nil {
+				return false, err
+			} else if len(srcDir) > 0 {
+				defer os.RemoveAll(srcDir)
+				srcImp = r.Origin
+			}
+		}
+	} else if len(upstream) == 0 {
+		return false, fmt.Errorf("no upstream path and no record in %s", dir)
+	}
+	if len(srcDir) == 0 {
+		srcPkg, err := getPackage(ctx, cwd, upstream)
+		if len(srcPkg.Dir) == 0 || len(srcPkg.ImportPath) == 0 {
+			if err == nil {
+				return false, fmt.Errorf("package has no directory or import path")
+			}
+			return false, err
+		}
+		srcDir, srcImp = srcPkg.Dir, srcPkg.ImportPath
+	}
+	rwr := newRewriter(ctx, dir, dstImp)
+	rwr.group = nil
+	if regroup {
+		rwr.group = importGroup(ctx, cwd, []string{dstImp})
+	}
+	srcFiles, err := listFiles(srcDir, hidden)
+	if err != nil {
+		return false, err
+	}
+	dstFiles, err := listFiles(dir, hidden)
+	if err != nil {
+		return false, err
+	}
+	rels := make([]string, 0, len(srcFiles))
+	for rel := range srcFiles {
+		rels = append(rels, rel)
+	}
+	for rel := range dstFiles {
+		if _, ok := srcFiles[rel]; !ok {
+			rels = append(rels, rel)
+		}
+	}
+	sort.Strings(rels)
+	for _, rel := range rels {
+		var a, b []byte
+		aName, bName := "a/"+rel, "b/"+rel
+		if path, ok := srcFiles[rel]; !ok {
+			aName = "/dev/null"
+		} else if a, err = getFileContents(path); err != nil {
+			return found, err
+		} else if strings.HasSuffix(rel, ".go") {
+			if a, err = cpTransform(path, a, srcImp, dstImp, canonical, rwr); err != nil {
+				return found, err
+			}
+		}
+		if path, ok := dstFiles[rel]; !ok {
+			bName = "/dev/null"
+		} else if b, err = getFileContents(path); err != nil {
+			return found, err
+		}
+		if aName != "/dev/null" && bName != "/dev/null" && bytes.Equal(a, b) {
+			continue
+		}
+		found = true
+		if isBinary(a) || isBinary(b) {
+			fmt.Fprintf(w, "Binary files %s and %s differ\n", aName, bName)
+			continue
+		}
+		if _, err := io.WriteString(w, unifiedDiff(aName, bName, a, b, 3)); err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// listFiles returns a map of the slash separated paths, relative to the
+// directory, of all the regular files in the directory and its subdirectories
+// to their full paths. Skips records.
+// Skips hidden files based on the `hidden` parameter.
+func listFiles(dir string, hidden bool) (map[string]string, error) {
+	files := make(map[string]string)
+	walk := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if base := info.Name(); path != dir &&
+			!hidden && strings.HasPrefix(base, ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Name() == recordName {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = path
+		return nil
+	}
+	if err := filepath.Walk(dir, walk); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// isBinary checks whether the contents look like binary data, by checking for
+// a NUL byte.
+func isBinary(src []byte) bool {
+	return bytes.IndexByte(src, 0) != -1
+}
+
+// diffOp is the operation applied to a line in a diff.
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+// diffLine is a line in a diff along with the operation applied to it.
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// splitLines splits the contents into lines, keeping the line endings.
+func splitLines(src []byte) []string {
+	lines := make([]string, 0)
+	for len(src) > 0 {
+		i := bytes.IndexByte(src, '\n')
+		if i == -1 {
+			lines = append(lines, string(src))
+			break
+		}
+		lines = append(lines, string(src[:i+1]))
+		src = src[i+1:]
+	}
+	return lines
+}
+
+// diffLines computes the shortest edit script from the lines in a to the lines
+// in b using the Myers diff algorithm.
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// Keep a copy of the relevant portion of v for each step to backtrack,
+	// at step d the diagonals from -d-1 to d+1 are needed.
+	trace := make([][]int, 0)
+	var x, y int
+search:
+	for d := 0; d <= max; d++ {
+		snap := make([]int, 2*d+3)
+		copy(snap, v[offset-d-1:offset+d+2])
+		trace = append(trace, snap)
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+	// Backtrack through the trace to compile the lines in reverse.
+	rev := make([]diffLine, 0, max)
+	x, y = n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snap := trace[d]
+		at := func(k int) int { return snap[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, diffLine{diffEqual, a[x-1]})
+			x, y = x-1, y-1
+		}
+		if d > 0 {
+			if x == prevX {
+				rev = append(rev, diffLine{diffInsert, b[y-1]})
+			} else {
+				rev = append(rev, diffLine{diffDelete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	lines := make([]diffLine, len(rev))
+	for i, l := range rev {
+		lines[len(rev)-1-i] = l
+	}
+	return lines
+}
+
+// unifiedDiff returns a unified diff from the contents of a to b with n lines
+// of context, the names are used in the header. Returns an empty string if the
+// contents are equal.
+func unifiedDiff(aName, bName string, a, b []byte, n int) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+	// Group the changes into hunks, changes separated by no more than twice
+	// the context are placed into the same hunk.
+	type hunk struct{ start, end int }
+	hunks := make([]hunk, 0)
+	for i, l := range lines {
+		if l.op == diffEqual {
+			continue
+		}
+		start, end := i-n, i+n+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if last := len(hunks) - 1; last >= 0 && hunks[last].end >= start {
+			hunks[last].end = end
+		} else {
+			hunks = append(hunks, hunk{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+	var aLine, bLine, pos int // lines consumed before pos
+	for _, h := range hunks {
+		for ; pos < h.start; pos++ {
+			aLine, bLine = diffAdvance(lines[pos].op, aLine, bLine)
+		}
+		var aCount, bCount int
+		for _, l := range lines[h.start:h.end] {
+			aCount, bCount = diffAdvance(l.op, aCount, bCount)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+		for _, l := range lines[h.start:h.end] {
+			switch l.op {
+			case diffEqual:
+				buf.WriteByte(' ')
+			case diffDelete:
+				buf.WriteByte('-')
+			case diffInsert:
+				buf.WriteByte('+')
+			}
+			buf.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		for ; pos < h.end; pos++ {
+			aLine, bLine = diffAdvance(lines[pos].op, aLine, bLine)
+		}
+	}
+	return buf.String()
+}
+
+// diffAdvance advances the counts of lines from a and b based on the
+// operation applied to a line.
+func diffAdvance(op diffOp, a, b int) (int, int) {
+	switch op {
+	case diffEqual:
+		return a + 1, b + 1
+	case diffDelete:
+		return a + 1, b
+	default:
+		return a, b + 1
+	}
+}
+
+// hunkRange formats the range of a hunk header, the start is the number of
+// lines preceding the hunk.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	} else if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// unifiedDiffTests holds table tests for the unifiedDiff function.
+var unifiedDiffTests = []struct {
+	a, b string
+	out  string
+}{
+	{"a\nb\nc\n", "a\nb\nc\n", ""},
+	{
+		"a\nb\nc\n",
+		"a\nx\nc\n",
+		"--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+	},
+	{
+		"",
+		"a\n",
+		"--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+a\n",
+	},
+	{
+		"a\nb",
+		"a\nc",
+		"--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+	},
+	{
+		"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+		"0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+		"--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+	},
+}
+
+// TestUnifiedDiff tests the output of the unifiedDiff function.
+func TestUnifiedDiff(t *testing.T) {
+	for _, tt := range unifiedDiffTests {
+		out := unifiedDiff("a/f", "b/f", []byte(tt.a), []byte(tt.b), 3)
+		if out != tt.out {
+			t.Errorf("diff of %q to %q : got\n%s\nexpected\n%s",
+				tt.a, tt.b, out, tt.out)
+		}
+	}
+}
+
+// TestDiff tests the diff subcommand, checking that a fresh copy has no
+// differences from the upstream package, despite the import path changes made
+// while copying, and that local modifications are found.
+func TestDiff(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"), dstDir, false, false)
+	if err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	var buf bytes.Buffer
+	found, err := diffPackage(ctx, pkgDir, "lib/y", "other.com/y", &buf)
+	if err != nil {
+		t.Fatalf("error during diff : %s", err.Error())
+	} else if found {
+		t.Errorf("differences found in fresh copy :\n%s", buf.String())
+	}
+	// Modify the copy, use the recorded origin.
+	subPath := filepath.Join(dstDir, "sub", "sub.go")
+	src, err := getFileContents(subPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src = bytes.Replace(src, []byte("const TC int = 1"), []byte("const TC int = 2"), 1)
+	if err := ioutil.WriteFile(subPath, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	found, err = diffPackage(ctx, pkgDir, "lib/y", "", &buf)
+	if err != nil {
+		t.Fatalf("error during diff : %s", err.Error())
+	} else if !found {
+		t.Fatalf("differences not found in modified copy")
+	}
+	header := "--- a/sub/sub.go\n+++ b/sub/sub.go\n@@ -3,"
+	change := "-const TC int = 1\n+const TC int = 2\n"
+	if out := buf.String(); !strings.HasPrefix(out, header) ||
+		!strings.Contains(out, change) {
+		t.Errorf("diff : got\n%s\nexpected header\n%s\nand change\n%s",
+			out, header, change)
+	}
+}
+
+// TestDiffHidden tests that hidden files are compared as recorded in the copy,
+// regardless of the opt.hidden option.
+func TestDiffHidden(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func(hidden bool) { opt.hidden = hidden }(opt.hidden)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"), dstDir, false, true)
+	if err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(dstDir, ".hidden"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt.hidden = false
+	var buf bytes.Buffer
+	if found, err := diffPackage(ctx, pkgDir, "lib/y", "", &buf); err != nil {
+		t.Fatalf("error during diff : %s", err.Error())
+	} else if out := buf.String(); !found || !strings.HasPrefix(out, "--- a/.hidden\n+++ b/.hidden\n") {
+		t.Errorf("expected the modified hidden file, got :\n%s", out)
+	}
+	// Without hidden files in the copy, the upstream ones are not deleted.
+	dstDir = filepath.Join(pkgDir, "lib", "z")
+	err = cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"), dstDir, false, false)
+	if err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	opt.hidden = true
+	buf.Reset()
+	if found, err := diffPackage(ctx, pkgDir, "lib/z", "", &buf); err != nil {
+		t.Fatalf("error during diff : %s", err.Error())
+	} else if found {
+		t.Errorf("differences found in fresh copy :\n%s", buf.String())
+	}
+}
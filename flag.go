@@ -37,6 +37,40 @@ type optHolder struct {
 	// hidden flag includes hidden files, starting with a dot, when copying
 	// or moving files.
 	hidden bool
+	// update flag accepts changes to copied packages, updating their
+	// records.
+	update bool
+	// json flag outputs in JSON.
+	json bool
+	// group flag regroups the imports of rewritten files into standard,
+	// third-party, and local groups.
+	group bool
+	// selectors flag renames qualified identifiers when the package name of
+	// a rewritten import changes, instead of adding an import name.
+	selectors bool
+	// interactive flag prompts for unique names of packages with duplicate
+	// package names.
+	interactive bool
+	// importPath flag sets the import path of a package exported from a
+	// repository.
+	importPath string
+	// allowCycles flag warns instead of failing when an operation would
+	// introduce an import cycle.
+	allowCycles bool
+	// fix flag fixes the reported problems where possible.
+	fix bool
+	// all flag outputs all the results instead of only the first one.
+	all bool
+	// canonical flag rewrites canonical import paths of copied packages to
+	// their new import path instead of stripping them.
+	canonical bool
+	// wait flag waits for the project lock to be released instead of
+	// failing.
+	wait bool
+	// sync flag replaces only the files of an existing copy that differ.
+	sync bool
+	// copyMode flag sets how files are copied, see copyFile.
+	copyMode string
 }
 
 // opt argumes passed into the command.
@@ -46,7 +80,7 @@ var opt optHolder = optHolder{}
 func init() {
 	// Main flagset
 	main := flag.NewFlagSet("main", flag.ExitOnError)
-	main.Usage = usage(main, mainUsage)
+	main.Usage = mainUsageFunc
 	flagMap["main"] = main
 	// List flagset
 	list := flag.NewFlagSet("list", flag.ExitOnError)
@@ -67,6 +101,14 @@ func init() {
 	info.Usage = usage(info, infoUsage)
 	info.BoolVar(&opt.verbose, "v", false, "detailed output")
 	flagMap["info"] = info
+	// Why flagset
+	why := flag.NewFlagSet("why", flag.ExitOnError)
+	why.Usage = usage(why, whyUsage)
+	why.BoolVar(&opt.recurse, "r", false,
+		"include imports from packages located in subdirectories")
+	why.BoolVar(&opt.all, "all", false,
+		"outputs all the import chains instead of the shortest one")
+	flagMap["why"] = why
 	// Init flagset
 	init := flag.NewFlagSet("init", flag.ExitOnError)
 	init.Usage = usage(init, initUsage)
@@ -75,8 +117,22 @@ func init() {
 		"recurse into subdirectories to include their dependencies")
 	init.BoolVar(&opt.force, "f", false,
 		"forces copy, replaces destination folder")
+	init.BoolVar(&opt.sync, "sync", false,
+		"replace only the files of an existing destination folder that differ, keeping the others untouched")
+	init.StringVar(&opt.copyMode, "copy-mode", "copy",
+		"how files are copied, copy, hardlink, or reflink, falling back to copy")
 	init.BoolVar(&opt.hidden, "i", false,
 		"include hidden files, files starting with a dot")
+	init.BoolVar(&opt.canonical, "k", false,
+		"rewrite canonical import paths to the new import path instead of stripping them")
+	init.BoolVar(&opt.group, "group", false,
+		"regroup imports of rewritten files into standard, third-party, and local groups")
+	init.BoolVar(&opt.selectors, "selectors", false,
+		"rename qualified identifiers when the package name of a rewritten import changes, instead of adding an import name")
+	init.BoolVar(&opt.interactive, "interactive", false,
+		"prompt for unique names of packages with duplicate package names")
+	init.BoolVar(&opt.wait, "wait", false,
+		"wait for the project lock held by another process instead of failing")
 	flagMap["init"] = init
 	// Cp flagset
 	cp := flag.NewFlagSet("cp", flag.ExitOnError)
@@ -86,8 +142,22 @@ func init() {
 		"recurse into subdirectories to update their import paths of the copied packages")
 	cp.BoolVar(&opt.force, "f", false,
 		"forces copy, replaces destination folder")
+	cp.BoolVar(&opt.sync, "sync", false,
+		"replace only the files of an existing destination folder that differ, keeping the others untouched")
+	cp.StringVar(&opt.copyMode, "copy-mode", "copy",
+		"how files are copied, copy, hardlink, or reflink, falling back to copy")
 	cp.BoolVar(&opt.hidden, "i", false,
 		"include hidden files, files starting with a dot")
+	cp.BoolVar(&opt.canonical, "k", false,
+		"rewrite canonical import paths to the new import path instead of stripping them")
+	cp.BoolVar(&opt.group, "group", false,
+		"regroup imports of rewritten files into standard, third-party, and local groups")
+	cp.BoolVar(&opt.selectors, "selectors", false,
+		"rename qualified identifiers when the package name of a rewritten import changes, instead of adding an import name")
+	cp.BoolVar(&opt.allowCycles, "allow-cycles", false,
+		"warn instead of failing when the updated imports would form an import cycle")
+	cp.BoolVar(&opt.wait, "wait", false,
+		"wait for the project lock held by another process instead of failing")
 	flagMap["cp"] = cp
 	// Mv flagset
 	mv := flag.NewFlagSet("mv", flag.ExitOnError)
@@ -97,14 +167,110 @@ func init() {
 		"recurse into subdirectories to update their import paths of the moved packages")
 	mv.BoolVar(&opt.force, "f", false,
 		"forces move, replaces destination folder")
+	mv.StringVar(&opt.copyMode, "copy-mode", "copy",
+		"how files are copied, copy, hardlink, or reflink, falling back to copy")
 	mv.BoolVar(&opt.hidden, "i", false,
 		"include hidden files, files starting with a dot")
+	mv.BoolVar(&opt.canonical, "k", false,
+		"rewrite canonical import paths to the new import path instead of stripping them")
+	mv.BoolVar(&opt.group, "group", false,
+		"regroup imports of rewritten files into standard, third-party, and local groups")
+	mv.BoolVar(&opt.selectors, "selectors", false,
+		"rename qualified identifiers when the package name of a rewritten import changes, instead of adding an import name")
+	mv.BoolVar(&opt.allowCycles, "allow-cycles", false,
+		"warn instead of failing when the updated imports would form an import cycle")
+	mv.BoolVar(&opt.wait, "wait", false,
+		"wait for the project lock held by another process instead of failing")
 	flagMap["mv"] = mv
+	// Get flagset
+	get := flag.NewFlagSet("get", flag.ExitOnError)
+	get.Usage = usage(get, getUsage)
+	get.BoolVar(&opt.verbose, "v", false, "detailed output")
+	get.BoolVar(&opt.recurse, "r", false,
+		"recurse into subdirectories to update their import paths of the exported package")
+	get.BoolVar(&opt.force, "f", false,
+		"forces copy, replaces destination folder")
+	get.BoolVar(&opt.sync, "sync", false,
+		"replace only the files of an existing destination folder that differ, keeping the others untouched")
+	get.StringVar(&opt.copyMode, "copy-mode", "copy",
+		"how files are copied, copy, hardlink, or reflink, falling back to copy")
+	get.BoolVar(&opt.hidden, "i", false,
+		"include hidden files, files starting with a dot")
+	get.BoolVar(&opt.canonical, "k", false,
+		"rewrite canonical import paths to the new import path instead of stripping them")
+	get.BoolVar(&opt.group, "group", false,
+		"regroup imports of rewritten files into standard, third-party, and local groups")
+	get.BoolVar(&opt.selectors, "selectors", false,
+		"rename qualified identifiers when the package name of a rewritten import changes, instead of adding an import name")
+	get.StringVar(&opt.importPath, "import", "",
+		"import path of the exported package, by default determined from its canonical import path")
+	get.BoolVar(&opt.wait, "wait", false,
+		"wait for the project lock held by another process instead of failing")
+	flagMap["get"] = get
 	// Path flagset
 	path := flag.NewFlagSet("path", flag.ExitOnError)
 	path.Usage = usage(path, pathUsage)
 	path.BoolVar(&opt.verbose, "v", false, "detailed output")
 	path.BoolVar(&opt.recurse, "r", false,
 		"recurse into subdirectories to update their import paths")
+	path.BoolVar(&opt.group, "group", false,
+		"regroup imports of rewritten files into standard, third-party, and local groups")
+	path.BoolVar(&opt.selectors, "selectors", false,
+		"rename qualified identifiers when the package name of a rewritten import changes, instead of adding an import name")
+	path.BoolVar(&opt.allowCycles, "allow-cycles", false,
+		"warn instead of failing when the updated imports would form an import cycle")
+	path.BoolVar(&opt.wait, "wait", false,
+		"wait for the project lock held by another process instead of failing")
 	flagMap["path"] = path
+	// Prune flagset
+	prune := flag.NewFlagSet("prune", flag.ExitOnError)
+	prune.Usage = usage(prune, pruneUsage)
+	prune.BoolVar(&opt.verbose, "v", false, "detailed output")
+	prune.BoolVar(&opt.force, "f", false,
+		"forces removal of the unused packages")
+	prune.BoolVar(&opt.wait, "wait", false,
+		"wait for the project lock held by another process instead of failing")
+	flagMap["prune"] = prune
+	// Verify flagset
+	verify := flag.NewFlagSet("verify", flag.ExitOnError)
+	verify.Usage = usage(verify, verifyUsage)
+	verify.BoolVar(&opt.verbose, "v", false, "detailed output")
+	verify.BoolVar(&opt.update, "update", false,
+		"accept the changes, updating the recorded digests")
+	verify.BoolVar(&opt.wait, "wait", false,
+		"wait for the project lock held by another process instead of failing")
+	flagMap["verify"] = verify
+	// Diff flagset
+	diff := flag.NewFlagSet("diff", flag.ExitOnError)
+	diff.Usage = usage(diff, diffUsage)
+	diff.BoolVar(&opt.hidden, "i", false,
+		"include hidden files, files starting with a dot")
+	flagMap["diff"] = diff
+	// Patch flagset
+	patch := flag.NewFlagSet("patch", flag.ExitOnError)
+	patch.Usage = usage(patch, patchUsage)
+	patch.BoolVar(&opt.verbose, "v", false, "detailed output")
+	patch.BoolVar(&opt.hidden, "i", false,
+		"include hidden files, files starting with a dot, when saving")
+	patch.BoolVar(&opt.wait, "wait", false,
+		"wait for the project lock held by another process instead of failing")
+	flagMap["patch"] = patch
+	// Check flagset
+	check := flag.NewFlagSet("check", flag.ExitOnError)
+	check.Usage = usage(check, checkUsage)
+	check.BoolVar(&opt.verbose, "v", false, "detailed output")
+	check.BoolVar(&opt.fix, "fix", false,
+		"rewrite leaking imports to import their copies, where copied")
+	check.BoolVar(&opt.wait, "wait", false,
+		"wait for the project lock held by another process instead of failing")
+	flagMap["check"] = check
+	// Completion flagset
+	completion := flag.NewFlagSet("completion", flag.ExitOnError)
+	completion.Usage = usage(completion, completionUsage)
+	flagMap["completion"] = completion
+	// Status flagset
+	status := flag.NewFlagSet("status", flag.ExitOnError)
+	status.Usage = usage(status, statusUsage)
+	status.BoolVar(&opt.json, "json", false, "output in JSON")
+	flagMap["status"] = status
 }
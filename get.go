@@ -0,0 +1,203 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// get runs the get subcommand, exports the tree of the local Git repository
+// located at `repo`, a directory or a file:// URL, at the `rev` revision into
+// the `dst` directory, without the package being present in the GOPATH.
+// The import path of the package is determined from the canonical import path
+// of the files in the root of the tree, or set with the opt.importPath option.
+// Updates import paths for the package in the current working directory,
+// recursing into subdirectories based on the `recurse` parameter, see cp.
+// Includes hidden files (staring with a dot) when copying files based on the
+// `hidden` parameter.
+// Records the repository and the revision along with the digests of the copy.
+// Once the `cctx` context is done stops as cp does.
+func get(cctx context.Context, ctx *build.Context, cwd, repo, rev, dst string, recurse, hidden bool) error {
+	repo, err := repoDir(cwd, repo)
+	if err != nil {
+		return err
+	}
+	if dst, err = cwdAbs(cwd, dst); err != nil {
+		return err
+	}
+	// Resolve the revision, so the record refers to an exact commit.
+	out, err := git(repo, nil, "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return err
+	}
+	commit := strings.TrimSpace(string(out))
+	// Export the tree into a temporary directory.
+	tmp, err := exportTree(repo, commit)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	imp := opt.importPath
+	if len(imp) == 0 {
+		if imp, err = treeImportPath(tmp); err != nil {
+			return err
+		}
+	}
+	if opt.verbose {
+		fmt.Printf("exporting %s at %s as %s\n", repo, commit, imp)
+	}
+	// Validate before making any changes.
+	if p := checkCopy(ctx, cwd, imp, tmp, dst, recurse); len(p) > 0 {
+		return p
+	} else if err := checkDst(dst); err != nil {
+		return err
+	}
+	// Copy the package over, see cp.
+	dstTmp, err := tempDir(dst)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dstTmp)
+	if err := copyDir(cctx, tmp, dstTmp, hidden, linkFiles(imp, tmp, dst)); err != nil {
+		return copyInterrupted(err, imp, dst)
+	}
+	r := &record{Origin: imp, Hidden: hidden, Canonical: opt.canonical,
+		Group: opt.group, VCS: &vcsInfo{Type: "git", Repo: repo, Rev: commit, Exported: true}}
+	return finishCopy(cctx, ctx, cwd, tmp, dstTmp, dst, recurse, r)
+}
+
+// exportTree exports the tree of the `rev` revision of the local Git repository
+// located at `repo` into a new temporary directory, which the caller removes.
+func exportTree(repo, rev string) (string, error) {
+	tmp, err := ioutil.TempDir("", "vend-get")
+	if err != nil {
+		return "", err
+	}
+	var archive bytes.Buffer
+	if _, err := git(repo, &archive, "archive", "--format=tar", rev); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if err := extractTar(&archive, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// exportRecord exports the upstream package of the copy made by get, with the
+// record, from the repository and the revision it recorded, into a new
+// temporary directory which the caller removes, see exportTree.
+// Returns an empty directory for the copies that were not exported, whose
+// upstream package is found through the GOPATH instead.
+func exportRecord(r *record) (string, error) {
+	if r.VCS == nil || !r.VCS.Exported {
+		return "", nil
+	}
+	return exportTree(r.VCS.Repo, r.VCS.Rev)
+}
+
+// repoDir returns the absolute path of the repository specified by a directory,
+// relative to the current working directory, or by a file:// URL.
+func repoDir(cwd, repo string) (string, error) {
+	if strings.HasPrefix(repo, "file://") {
+		u, err := url.Parse(repo)
+		if err != nil {
+			return "", err
+		} else if len(u.Host) > 0 && u.Host != "localhost" {
+			return "", fmt.Errorf("unsupported host in %s", repo)
+		}
+		return filepath.FromSlash(u.Path), nil
+	} else if strings.Contains(repo, "://") {
+		return "", fmt.Errorf("unsupported repository %s, must be local", repo)
+	}
+	return cwdAbs(cwd, repo)
+}
+
+// extractTar extracts the directories and regular files in the tar archive into
+// the `dst` directory. Symbolic links are skipped, as packages are copied
+// without them, see copyFile, with the opt.verbose option set outputs them.
+// Fails on entries that would be placed outside of the directory.
+func extractTar(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := filepath.Join(dst, filepath.FromSlash(hdr.Name))
+		if !isChildDir(dst, name) && name != dst {
+			return fmt.Errorf("archive entry %s outside of the directory", hdr.Name)
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(name, mode|0700)
+		case tar.TypeReg:
+			err = extractFile(tr, name, mode)
+		case tar.TypeSymlink:
+			if opt.verbose {
+				fmt.Printf("skipping symbolic link %s\n", hdr.Name)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractFile writes the contents of the reader to a new file with the mode,
+// creating its directory as necessary.
+func extractFile(r io.Reader, name string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// treeImportPath determines the import path of the package in the directory
+// from the canonical import paths of its Go files. Fails if there is none or
+// they disagree.
+func treeImportPath(dir string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", err
+	}
+	var imp string
+	for _, f := range files {
+		src, err := getFileContents(f)
+		if err != nil {
+			return "", err
+		}
+		ci, ok := findCanonicalImportPath(src)
+		switch {
+		case !ok:
+		case len(imp) == 0:
+			imp = ci.path
+		case imp != ci.path:
+			return "", fmt.Errorf("conflicting canonical import paths %s and %s", imp, ci.path)
+		}
+	}
+	if len(imp) == 0 {
+		return "", fmt.Errorf("no canonical import path found, set the import path with the -import flag")
+	}
+	return imp, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testGitRepo creates a Git repository with the files committed in order, each
+// map of file names to contents is a separate commit, tagged v1, v2, and so on.
+// Returns the directory of the repository.
+func testGitRepo(t *testing.T, commits ...map[string]string) string {
+	dir, err := ioutil.TempDir("", "vend-repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testGit(t, dir, "init", "-q")
+	for i, files := range commits {
+		for name, src := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testGit(t, dir, "add", "-A")
+		testGit(t, dir, "commit", "-q", "-m", "commit")
+		testGit(t, dir, "tag", "v"+string('1'+rune(i)))
+	}
+	return dir
+}
+
+// testGit runs the git command with the arguments in the directory, returns the
+// trimmed output. Skips the test if git is not found.
+func testGit(t *testing.T, dir string, args ...string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	args = append([]string{"-c", "user.name=vend", "-c", "user.email=vend@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s : %s", strings.Join(args, " "), out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// TestGet tests the get subcommand, exporting a package from a Git repository
+// at a tag, checks that the import paths are updated, that the copy builds, and
+// that the repository and revision are recorded and used as its upstream.
+func TestGet(t *testing.T) {
+	repo := testGitRepo(t, map[string]string{
+		"r.go":     "package r // import \"other.com/r\"\n\nimport \"other.com/r/sub\"\n\nvar V = sub.V\n",
+		"sub/s.go": "package sub\n\nconst V = 1\n",
+	}, map[string]string{
+		"r.go": "package r // import \"other.com/r\"\n\nvar V = 2\n",
+	})
+	defer os.RemoveAll(repo)
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "get"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	if err := get(context.Background(), ctx, pkgDir, "file://"+filepath.ToSlash(repo), "v1", "lib/r", false, false); err != nil {
+		t.Fatalf("get error : %s", err.Error())
+	}
+	rDir := filepath.Join(pkgDir, "lib", "r")
+	testImports(t, pkgDir, []string{"example.com/x/lib/r"}, false)
+	testImports(t, rDir, []string{"example.com/x/lib/r/sub"}, false)
+	testBuild(t, rDir)
+	r, err := readRecord(rDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev := testGit(t, repo, "rev-parse", "v1^{commit}")
+	if r.Origin != "other.com/r" || r.VCS == nil || r.VCS.Type != "git" ||
+		r.VCS.Repo != repo || r.VCS.Rev != rev || !r.VCS.Exported {
+		t.Errorf("unexpected record : %+v %+v", r, r.VCS)
+	}
+	// The upstream package is the recorded revision, not in the GOPATH.
+	sts, err := getStatus(ctx, pkgDir, "lib")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(sts) != 1 || sts[0].UpstreamMissing || sts[0].UpstreamNewer {
+		t.Errorf("unexpected status : %+v", sts)
+	}
+	var buf bytes.Buffer
+	if found, err := diffPackage(ctx, pkgDir, "lib/r", "", &buf); err != nil {
+		t.Fatal(err)
+	} else if found {
+		t.Errorf("unexpected differences :\n%s", buf.String())
+	}
+	f, err := os.OpenFile(filepath.Join(rDir, "sub", "s.go"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\nconst W = 2\n")
+	f.Close()
+	if found, err := diffPackage(ctx, pkgDir, "lib/r", "", &buf); err != nil {
+		t.Fatal(err)
+	} else if !found || !strings.Contains(buf.String(), "+++ b/sub/s.go") {
+		t.Errorf("expected the modification of sub/s.go, got :\n%s", buf.String())
+	}
+	// Without a canonical import path the import path must be set.
+	os.RemoveAll(rDir)
+	repo2 := testGitRepo(t, map[string]string{"r.go": "package r\n"})
+	defer os.RemoveAll(repo2)
+	if err := get(context.Background(), ctx, pkgDir, repo2, "v1", "lib/r", false, false); err == nil ||
+		!strings.Contains(err.Error(), "-import") {
+		t.Errorf("expected missing import path error, got %v", err)
+	}
+	testExists(t, rDir, false)
+}
+
+// TestGetSymlink tests that the get subcommand skips the symbolic links of the
+// exported tree.
+func TestGetSymlink(t *testing.T) {
+	repo := testGitRepo(t, map[string]string{
+		"r.go": "package r // import \"other.com/r\"\n",
+	})
+	defer os.RemoveAll(repo)
+	if err := os.Symlink("r.go", filepath.Join(repo, "link.go")); err != nil {
+		t.Skip("symbolic links not supported")
+	}
+	testGit(t, repo, "add", "-A")
+	testGit(t, repo, "commit", "-q", "-m", "link")
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "get"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	if err := get(context.Background(), ctx, pkgDir, repo, "HEAD", "lib/r", false, false); err != nil {
+		t.Fatalf("get error : %s", err.Error())
+	}
+	rDir := filepath.Join(pkgDir, "lib", "r")
+	testExists(t, filepath.Join(rDir, "r.go"), true)
+	if _, err := os.Lstat(filepath.Join(rDir, "link.go")); !os.IsNotExist(err) {
+		t.Errorf("expected the symbolic link to be skipped, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"go/build"
+)
+
+// importEdge is an import of a package in an importGraph.
+type importEdge struct {
+	// path is the import path of the imported package.
+	path string
+	// test is whether the package is only imported by test files.
+	test bool
+}
+
+// importEdges lists the imports of a package in an importGraph.
+type importEdges []importEdge
+
+// importGraph maps the import paths of packages to their imports.
+type importGraph map[string]importEdges
+
+// buildImportGraph compiles the import graph of the `roots` packages and all
+// the packages they depend on, directly or indirectly. The imports of test
+// files are only included for the `roots` packages, marked as test edges unless
+// the package itself also imports them.
+// Standard packages are only followed if `std` is true, as they only import
+// other standard packages. Packages that cannot be found have no imports.
+func buildImportGraph(ctx *build.Context, cwd string, roots []*build.Package, std bool) importGraph {
+	g := make(importGraph)
+	queue := make([]string, 0)
+	add := func(pkg *build.Package, tests bool) {
+		edges := make(importEdges, 0)
+		for _, imp := range getImports(pkg, tests) {
+			edges = append(edges, importEdge{imp, !hasString(pkg.Imports, imp)})
+			queue = append(queue, imp)
+		}
+		g[pkg.ImportPath] = edges
+	}
+	for _, pkg := range roots {
+		add(pkg, true)
+	}
+	for len(queue) > 0 {
+		imp := queue[0]
+		queue = queue[1:]
+		if _, ok := g[imp]; ok {
+			continue
+		}
+		if pkg, err := getPackage(ctx, cwd, imp); err != nil || (pkg.Goroot && !std) {
+			g[imp] = nil
+		} else {
+			add(pkg, false)
+		}
+	}
+	return g
+}
+
+// shortestChain finds the shortest chain of imports from any of the `from`
+// packages to the `to` package, through a breadth first search.
+// Returns the chain as a slice of edges, starting with an edge to the first
+// package, nil if the package is not imported.
+func (g importGraph) shortestChain(from []string, to string) []importEdge {
+	chains := make(map[string][]importEdge)
+	queue := make([]string, 0, len(from))
+	for _, p := range from {
+		if _, ok := chains[p]; !ok {
+			chains[p] = []importEdge{{path: p}}
+			queue = append(queue, p)
+		}
+	}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if p == to {
+			return chains[p]
+		}
+		chain := chains[p]
+		for _, e := range g[p] {
+			if _, ok := chains[e.path]; !ok {
+				// Limit the capacity so chains do not share elements.
+				chains[e.path] = append(chain[:len(chain):len(chain)], e)
+				queue = append(queue, e.path)
+			}
+		}
+	}
+	return nil
+}
+
+// allChains finds all the chains of imports from any of the `from` packages to
+// the `to` package that do not pass through a package twice, see shortestChain.
+func (g importGraph) allChains(from []string, to string) [][]importEdge {
+	// Only follow the packages that lead to the target.
+	reaches := g.importers(to)
+	chains := make([][]importEdge, 0)
+	onChain := make(map[string]bool)
+	var walk func(chain []importEdge)
+	walk = func(chain []importEdge) {
+		last := chain[len(chain)-1].path
+		if last == to {
+			chains = append(chains, append([]importEdge(nil), chain...))
+			return
+		}
+		onChain[last] = true
+		for _, e := range g[last] {
+			if reaches[e.path] && !onChain[e.path] {
+				walk(append(chain, e))
+			}
+		}
+		onChain[last] = false
+	}
+	for _, p := range from {
+		if reaches[p] {
+			walk([]importEdge{{path: p}})
+		}
+	}
+	return chains
+}
+
+// importers returns the set of packages that import the package at the import
+// `path`, directly or indirectly, including the package itself.
+func (g importGraph) importers(path string) map[string]bool {
+	rev := make(map[string][]string)
+	for p, edges := range g {
+		for _, e := range edges {
+			rev[e.path] = append(rev[e.path], p)
+		}
+	}
+	found := map[string]bool{path: true}
+	queue := []string{path}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, i := range rev[p] {
+			if !found[i] {
+				found[i] = true
+				queue = append(queue, i)
+			}
+		}
+	}
+	return found
+}
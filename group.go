@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"sort"
+
+	"github.com/emil2k/vend/lib/astutil"
+)
+
+// Import groups, in the order they are placed in an import declaration.
+const (
+	stdGroup = iota
+	thirdPartyGroup
+	localGroup
+)
+
+// importGroup makes a function that returns the group of an import path, it is
+// either a standard package, a third-party package, or a local package located
+// in one of the passed import paths. Used to regroup imports with the
+// opt.group option set.
+func importGroup(ctx *build.Context, cwd string, local []string) func(imp string) int {
+	return func(imp string) int {
+		for _, l := range local {
+			if isImportIn(l, imp) {
+				return localGroup
+			}
+		}
+		if isStandardPackage(ctx, cwd, imp) {
+			return stdGroup
+		}
+		return thirdPartyGroup
+	}
+}
+
+// regroupImports sorts and regroups the specs of every parenthesized import
+// declaration in the parsed file, with the source src, into the groups
+// determined by the passed function separated by blank lines. Only the bytes
+// between the parentheses of declarations that are not already grouped are
+// replaced.
+// Declarations containing comments that are not attached to a spec are left
+// alone, as they cannot be moved safely.
+// Returns the resulting source and whether it was changed.
+func regroupImports(fs *token.FileSet, f *ast.File, src []byte, group func(imp string) int) ([]byte, bool) {
+	nl := "\n"
+	if bytes.Contains(src, []byte("\r\n")) {
+		nl = "\r\n"
+	}
+	offset := func(p token.Pos) int { return fs.Position(p).Offset }
+	existing := astutil.Imports(fs, f)
+	edits := make([]edit, 0)
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT || !gen.Lparen.IsValid() ||
+			len(gen.Specs) < 2 || hasLooseComments(f, gen) {
+			continue
+		}
+		// Sort the specs into the groups.
+		groups := make([][]*ast.ImportSpec, localGroup+1)
+		for _, s := range gen.Specs {
+			is := s.(*ast.ImportSpec)
+			g := group(specPath(is))
+			groups[g] = append(groups[g], is)
+		}
+		want := make([][]*ast.ImportSpec, 0, len(groups))
+		for _, g := range groups {
+			if len(g) > 0 {
+				sort.Stable(byImportPath(g))
+				want = append(want, g)
+			}
+		}
+		if sameGroups(declGroups(existing, gen), want) {
+			continue
+		}
+		// Replace the contents of the parentheses.
+		var buf bytes.Buffer
+		for i, g := range want {
+			if i > 0 {
+				buf.WriteString(nl)
+			}
+			for _, is := range g {
+				start, end := is.Pos(), is.End()
+				if is.Doc != nil {
+					start = is.Doc.Pos()
+				}
+				if is.Comment != nil {
+					end = is.Comment.End()
+				}
+				buf.WriteString(nl + "\t")
+				buf.Write(src[offset(start):offset(end)])
+			}
+		}
+		buf.WriteString(nl)
+		edits = append(edits, edit{
+			offset(gen.Lparen) + 1,
+			offset(gen.Rparen),
+			buf.String(),
+		})
+	}
+	if len(edits) == 0 {
+		return src, false
+	}
+	return applyEdits(src, edits), true
+}
+
+// hasLooseComments checks if the declaration contains comments that are not
+// attached to any of its specs.
+func hasLooseComments(f *ast.File, gen *ast.GenDecl) bool {
+	attached := make(map[*ast.CommentGroup]bool)
+	for _, s := range gen.Specs {
+		is := s.(*ast.ImportSpec)
+		attached[is.Doc] = true
+		attached[is.Comment] = true
+	}
+	for _, cg := range f.Comments {
+		if cg.Pos() > gen.Lparen && cg.End() < gen.Rparen && !attached[cg] {
+			return true
+		}
+	}
+	return false
+}
+
+// declGroups filters the import groups of a file, as returned by
+// astutil.Imports, to the ones belonging to the declaration.
+func declGroups(groups [][]*ast.ImportSpec, gen *ast.GenDecl) [][]*ast.ImportSpec {
+	in := make([][]*ast.ImportSpec, 0)
+	for _, g := range groups {
+		if len(g) > 0 && g[0].Pos() > gen.Lparen && g[0].End() < gen.Rparen {
+			in = append(in, g)
+		}
+	}
+	return in
+}
+
+// sameGroups checks whether both lists contain the same specs grouped and
+// ordered the same way.
+func sameGroups(a, b [][]*ast.ImportSpec) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// byImportPath sorts import specs by their import path.
+type byImportPath []*ast.ImportSpec
+
+func (s byImportPath) Len() int           { return len(s) }
+func (s byImportPath) Less(i, j int) bool { return specPath(s[i]) < specPath(s[j]) }
+func (s byImportPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// regroupImportsTests holds table tests for the regroupImports function.
+var regroupImportsTests = []struct {
+	src string
+	out string
+}{
+	{
+		// Already grouped.
+		"package x\n\nimport (\n\t\"fmt\"\n\n\t\"other.com/y\"\n)\n",
+		"package x\n\nimport (\n\t\"fmt\"\n\n\t\"other.com/y\"\n)\n",
+	},
+	{
+		// Mixed groups with attached comments.
+		"package x\n\nimport (\n\t\"other.com/y\" // third\n\t// doc\n\t\"example.com/x/lib/z\"\n\t\"fmt\"\n)\n",
+		"package x\n\nimport (\n\t\"fmt\"\n\n\t\"other.com/y\" // third\n\n\t// doc\n\t\"example.com/x/lib/z\"\n)\n",
+	},
+	{
+		// CRLF line endings.
+		"package x\r\n\r\nimport (\r\n\t\"example.com/x/lib/z\"\r\n\t\"fmt\"\r\n)\r\n",
+		"package x\r\n\r\nimport (\r\n\t\"fmt\"\r\n\r\n\t\"example.com/x/lib/z\"\r\n)\r\n",
+	},
+	{
+		// Loose comment, left alone.
+		"package x\n\nimport (\n\t\"other.com/y\"\n\n\t// loose\n\n\t\"fmt\"\n)\n",
+		"package x\n\nimport (\n\t\"other.com/y\"\n\n\t// loose\n\n\t\"fmt\"\n)\n",
+	},
+}
+
+// TestRegroupImports tests sorting and regrouping of imports.
+func TestRegroupImports(t *testing.T) {
+	group := func(imp string) int {
+		switch {
+		case strings.HasPrefix(imp, "example.com/x"):
+			return localGroup
+		case strings.Contains(imp, "."):
+			return thirdPartyGroup
+		}
+		return stdGroup
+	}
+	for _, tt := range regroupImportsTests {
+		fs := token.NewFileSet()
+		f, err := parser.ParseFile(fs, "x.go", tt.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ := regroupImports(fs, f, []byte(tt.src), group)
+		if string(out) != tt.out {
+			t.Errorf("regroup %q : got %q, expected %q", tt.src, out, tt.out)
+		}
+	}
+}
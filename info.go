@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go/build"
 	"sort"
@@ -36,7 +37,7 @@ func list(ctx *build.Context, cwd, path string) error {
 	if opt.recurse {
 		if abs, err := cwdAbs(cwd, path); err != nil {
 			return err
-		} else if err := recursePackages(ctx, abs, process); err != nil {
+		} else if err := recursePackages(context.Background(), ctx, abs, process); err != nil {
 			return err
 		}
 	} else if pkg, err := getPackage(ctx, cwd, path); err != nil {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go/build"
 	"path/filepath"
@@ -11,14 +12,22 @@ import (
 // package in the current working directory into the specified directory.
 // External packages are packages not located in the standard library, a parent
 // directory, or a subdirectory.
-// Files are placed in subdirectories based on their package name, if there are
+// Imports matching the exclude patterns of the project configuration are not
+// copied.
+// Files are placed in subdirectories based on their package name, or the name
+// set for the import path in the project configuration, if there are
 // conflicts the command will fail with a message, those specific packages will
 // need to be copied with the cp command, before running init again.
+// With the opt.interactive option set, and the standard input a terminal,
+// prompts for unique names instead, saving them in the project configuration.
 // Includes dependencies from packages located in subdirectories based on the
 // `recurse` parameter.
 // Includes hidden files (staring with a dot) when copying files based on the
 // `hidden` parameter.
-func initc(ctx *build.Context, cwd, dst string, recurse, hidden bool) error {
+// Validates all the copies before making any changes, see checkCopy.
+// Once the `cctx` context is done finishes the current copy or update and
+// returns an errInterrupted listing the ones done and the ones pending.
+func initc(cctx context.Context, ctx *build.Context, cwd, dst string, recurse, hidden bool) error {
 	dst, err := cwdAbs(cwd, dst)
 	if err != nil {
 		return err
@@ -36,6 +45,8 @@ func initc(ctx *build.Context, cwd, dst string, recurse, hidden bool) error {
 			return false // in a parent diretory
 		case isStandardPackage(ctx, cwd, i):
 			return false
+		case conf.excluded(i):
+			return false
 		}
 		return true
 	}
@@ -56,7 +67,11 @@ func initc(ctx *build.Context, cwd, dst string, recurse, hidden bool) error {
 					cpPkg.ImportPath)
 				continue
 			}
-			cpDst := filepath.Join(dst, cpPkg.Name)
+			name := cpPkg.Name
+			if n, ok := conf.Names[cpPkg.ImportPath]; ok {
+				name = n
+			}
+			cpDst := filepath.Join(dst, name)
 			if hasString(dsts, cpDst) {
 				if dstImpPath, err := getImportPath(ctx, cwd, cpDst); err != nil {
 					return err
@@ -69,38 +84,124 @@ func initc(ctx *build.Context, cwd, dst string, recurse, hidden bool) error {
 					cpJob{pkg.Dir, cpPkg.ImportPath, cpDst, false, hidden})
 			}
 			dsts = append(dsts, cpDst)
-			dups[cpPkg.Name] = appendUnique(dups[cpPkg.Name], cpPkg.ImportPath)
+			dups[name] = appendUnique(dups[name], cpPkg.ImportPath)
 		}
 		return nil
 	}
 	if recurse {
-		if err := recursePackages(ctx, cwd, process); err != nil {
+		if err := recursePackages(cctx, ctx, cwd, process); err != nil {
 			return err
 		}
 	} else if err := process(cwdPkg, nil); err != nil {
 		return err
 	}
-	// Report back if there is any packages with the same package name.
+	// Report back if there is any packages with the same package name, or
+	// with the opt.interactive option set prompt for unique names and start
+	// over.
 	for _, ps := range dups {
-		if len(ps) > 1 {
+		if len(ps) <= 1 {
+			continue
+		} else if !opt.interactive || !promptTerminal() {
 			return errDupe(dups)
 		}
+		names, err := promptNames(errDupe(dups), promptIn, promptOut)
+		if err != nil {
+			return err
+		}
+		if conf.Names == nil {
+			conf.Names = make(map[string]string)
+		}
+		for imp, name := range names {
+			conf.Names[imp] = name
+		}
+		if err := saveNames(projectRoot(ctx, cwd), names); err != nil {
+			return err
+		}
+		return initc(cctx, ctx, cwd, dst, recurse, hidden)
+	}
+	// Validate all the copies and updates before making any changes, the
+	// imports to update are checked once for each directory, see checkCopy.
+	p := make(errPreflight, 0)
+	type rewriteDir struct {
+		cwd     string
+		recurse bool
+	}
+	rewrites := make(map[rewriteDir][]string)
+	rewriteDirs := make([]rewriteDir, 0)
+	addRewrite := func(cwd, from string, recurse bool) {
+		rd := rewriteDir{cwd, recurse}
+		if _, ok := rewrites[rd]; !ok {
+			rewriteDirs = append(rewriteDirs, rd)
+		}
+		rewrites[rd] = appendUnique(rewrites[rd], from)
 	}
-	// Run copy command on each import.
 	for _, cj := range cps {
-		if err := cp(ctx, cj.cwd, cj.src, cj.dst, cj.recurse, cj.hidden); err != nil {
-			return err
+		srcPkg, err := getPackage(ctx, cwd, cj.src)
+		if len(srcPkg.Dir) == 0 {
+			msg := fmt.Sprintf("can't resolve the source %s", cj.src)
+			if err != nil {
+				msg += " : " + err.Error()
+			}
+			p = appendUnique(p, msg)
+			continue
+		}
+		if dst, err := cwdAbs(cwd, cj.dst); err == nil {
+			for _, msg := range checkCopyFiles(ctx, cj.cwd, srcPkg.Dir, dst) {
+				p = appendUnique(p, msg)
+			}
 		}
+		addRewrite(cj.cwd, cj.src, cj.recurse)
 	}
-	// Run update commands on other packages that need updating.
 	for _, uj := range updates {
-		if err := path(ctx, uj.src, uj.from, uj.to, uj.recurse); err != nil {
+		addRewrite(uj.src, uj.from, uj.recurse)
+	}
+	for _, rd := range rewriteDirs {
+		for _, msg := range checkRewrite(ctx, rd.cwd, rd.recurse, rewrites[rd]...) {
+			p = appendUnique(p, msg)
+		}
+	}
+	if len(p) > 0 {
+		return p
+	}
+	// Run copy command on each import, then run update commands on other
+	// packages that need updating.
+	done := make([]string, 0, len(cps)+len(updates))
+	for i, cj := range cps {
+		pending := jobsPending(cps[i:], updates)
+		if err := interrupted(cctx, done, pending); err != nil {
 			return err
 		}
+		err := cp(cctx, ctx, cj.cwd, cj.src, cj.dst, cj.recurse, cj.hidden)
+		if err != nil {
+			return wrapInterrupted(err, done, pending[1:])
+		}
+		done = append(done, fmt.Sprintf("copied %s to %s", cj.src, cj.dst))
+	}
+	for i, uj := range updates {
+		pending := jobsPending(nil, updates[i:])
+		if err := interrupted(cctx, done, pending); err != nil {
+			return err
+		}
+		if err := path(cctx, ctx, uj.src, uj.from, uj.to, uj.recurse); err != nil {
+			return wrapInterrupted(err, done, pending[1:])
+		}
+		done = append(done, fmt.Sprintf("updated the imports in %s", uj.src))
 	}
 	return nil
 }
 
+// jobsPending describes the pending cp and update calls.
+func jobsPending(cps []cpJob, updates []updateJob) []string {
+	pending := make([]string, 0, len(cps)+len(updates))
+	for _, cj := range cps {
+		pending = append(pending, fmt.Sprintf("copy %s to %s", cj.src, cj.dst))
+	}
+	for _, uj := range updates {
+		pending = append(pending, fmt.Sprintf("update the imports in %s", uj.src))
+	}
+	return pending
+}
+
 // errDupe is returned when there are duplicate package names when trying to
 // run the init command.
 // Underlying map is package name to a slice of import paths.
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -13,7 +14,7 @@ func TestInit(t *testing.T) {
 	ctx := getTestContextCopy(t, filepath.Join("testdata", "init"))
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
-	err := initc(ctx, pkgDir, "lib", false, false)
+	err := initc(context.Background(), ctx, pkgDir, "lib", false, false)
 	if err != nil {
 		t.Errorf("error during init : %s", err.Error())
 		t.FailNow()
@@ -41,7 +42,7 @@ func TestInitRecursive(t *testing.T) {
 	ctx := getTestContextCopy(t, filepath.Join("testdata", "init"))
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
-	err := initc(ctx, pkgDir, "lib", true, false)
+	err := initc(context.Background(), ctx, pkgDir, "lib", true, false)
 	if err != nil {
 		t.Errorf("error during init : %s", err.Error())
 		t.FailNow()
@@ -69,7 +70,7 @@ func TestInitDupe(t *testing.T) {
 	ctx := getTestContextCopy(t, filepath.Join("testdata", "init"))
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "dupe")
-	err := initc(ctx, pkgDir, "lib", false, false)
+	err := initc(context.Background(), ctx, pkgDir, "lib", false, false)
 	dupe, ok := err.(errDupe)
 	if err == nil || !ok {
 		t.Errorf("should return a duplicate package name error")
@@ -85,3 +86,23 @@ func TestInitDupe(t *testing.T) {
 			dupe.Error(), expected)
 	}
 }
+
+// TestInitConfig tests the init subcommand with the exclude patterns and naming
+// overrides of the project configuration.
+func TestInitConfig(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "init"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func() { conf = &config{} }()
+	conf = &config{
+		Exclude: []string{"other.com/*/b"},
+		Names:   map[string]string{"other.com/y/a1": "ya"},
+	}
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	if err := initc(context.Background(), ctx, pkgDir, "lib", false, false); err != nil {
+		t.Fatalf("error during init : %s", err.Error())
+	}
+	testImports(t, pkgDir,
+		[]string{"example.com/x/lib/ya", "other.com/y/b"}, false)
+	testExists(t, filepath.Join(pkgDir, "lib", "b"), false)
+	testBuild(t, filepath.Join(pkgDir, "lib", "ya"))
+}
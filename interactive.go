@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Input and output of the prompts, and whether the input is a terminal.
+var (
+	promptIn       io.Reader = os.Stdin
+	promptOut      io.Writer = os.Stdout
+	promptTerminal           = func() bool {
+		info, err := os.Stdin.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+)
+
+// promptNames prompts for a unique name for each import path in the duplicate
+// package names, offering suggestions. A blank answer accepts the first
+// suggestion, a number picks a suggestion, anything else is used as the name.
+// Prompts again for invalid names, and names already chosen for another import
+// path or held by another package.
+// Returns a map of the import paths to the chosen names.
+func promptNames(dups errDupe, in io.Reader, out io.Writer) (map[string]string, error) {
+	names := make([]string, 0, len(dups))
+	for name, paths := range dups {
+		if len(paths) > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	s := bufio.NewScanner(in)
+	chosen := make(map[string]string)
+	used := make(map[string]bool) // chosen names
+	taken := make(map[string]bool)
+	for name := range dups {
+		taken[name] = true
+	}
+	for _, name := range names {
+		fmt.Fprintf(out, "%s found at %s\n", name, strings.Join(dups[name], ", "))
+		for i, imp := range dups[name] {
+			sugs := suggestNames(name, imp, i == 0, taken)
+			for {
+				fmt.Fprintf(out, "name for %s", imp)
+				for j, sug := range sugs {
+					fmt.Fprintf(out, " %d) %s", j+1, sug)
+				}
+				fmt.Fprintf(out, " [%s] : ", sugs[0])
+				if !s.Scan() {
+					if err := s.Err(); err != nil {
+						return nil, err
+					}
+					return nil, fmt.Errorf("no name chosen for %s", imp)
+				}
+				answer := strings.TrimSpace(s.Text())
+				if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(sugs) {
+					answer = sugs[n-1]
+				} else if len(answer) == 0 {
+					answer = sugs[0]
+				}
+				if strings.ContainsAny(answer, `/\`) || answer == "." || answer == ".." {
+					fmt.Fprintf(out, "invalid name %s\n", answer)
+					continue
+				} else if used[answer] || (answer != name && len(dups[answer]) > 0) {
+					fmt.Fprintf(out, "name %s is already taken\n", answer)
+					continue
+				}
+				chosen[imp] = answer
+				taken[answer] = true
+				used[answer] = true
+				break
+			}
+		}
+	}
+	return chosen, nil
+}
+
+// suggestNames suggests unique names for the import path of a package with a
+// duplicate name, such as pq, lib_pq, and pq2 for github.com/lib/pq. The name
+// itself is only suggested to the first import path.
+func suggestNames(name, imp string, first bool, taken map[string]bool) []string {
+	sugs := make([]string, 0, 3)
+	if first {
+		sugs = append(sugs, name)
+	}
+	if parent := pathpkg.Base(pathpkg.Dir(imp)); parent != "." && parent != "/" {
+		parent = strings.Map(func(r rune) rune {
+			if r == '.' || r == '-' {
+				return '_'
+			}
+			return r
+		}, parent)
+		if sug := parent + "_" + name; !taken[sug] {
+			sugs = append(sugs, sug)
+		}
+	}
+	for n := 2; ; n++ {
+		if sug := name + strconv.Itoa(n); !taken[sug] {
+			return append(sugs, sug)
+		}
+	}
+}
+
+// saveNames saves the names chosen for import paths into the configuration
+// file in the `dir` directory, the project's root directory, see loadConfig,
+// adding them to its names. Creates a .vend.json file if there is none.
+func saveNames(dir string, names map[string]string) error {
+	tomlPath := filepath.Join(dir, configTOMLName)
+	jsonPath := filepath.Join(dir, configJSONName)
+	if _, err := os.Stat(jsonPath); os.IsNotExist(err) {
+		if _, err := os.Stat(tomlPath); err == nil {
+			return saveTOMLNames(tomlPath, names)
+		}
+	}
+	// Decode into a generic map to preserve the other settings.
+	c := make(map[string]interface{})
+	if src, err := getFileContents(jsonPath); err == nil {
+		if err := json.Unmarshal(src, &c); err != nil {
+			return fmt.Errorf("%s : %s", configJSONName, err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	saved, ok := c["names"].(map[string]interface{})
+	if !ok {
+		saved = make(map[string]interface{})
+	}
+	for imp, name := range names {
+		saved[imp] = name
+	}
+	c["names"] = saved
+	out, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFile(jsonPath, append(out, '\n'), 0644)
+}
+
+// saveTOMLNames saves the names chosen for import paths into the names table of
+// the TOML configuration file, replacing the lines of import paths already in
+// the table, adding the table if it is missing.
+func saveTOMLNames(path string, names map[string]string) error {
+	src, err := getFileContents(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(src), "\n"), "\n")
+	line := func(imp string) string {
+		return tomlQuote(imp) + " = " + tomlQuote(names[imp])
+	}
+	imps := make([]string, 0, len(names))
+	for imp := range names {
+		imps = append(imps, imp)
+	}
+	sort.Strings(imps)
+	// Find the names table and replace existing entries.
+	header, inNames := -1, false
+	saved := make(map[string]bool)
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "[") {
+			inNames = strings.HasPrefix(l, "[names]") &&
+				len(tomlTrimComment(l[len("[names]"):])) == 0
+			if inNames {
+				header = i
+			}
+			continue
+		}
+		if !inNames {
+			continue
+		}
+		if key, _, err := tomlKey(l); err == nil {
+			if _, ok := names[key]; ok {
+				lines[i] = line(key)
+				saved[key] = true
+			}
+		}
+	}
+	add := make([]string, 0, len(imps))
+	for _, imp := range imps {
+		if !saved[imp] {
+			add = append(add, line(imp))
+		}
+	}
+	if header == -1 {
+		lines = append(append(lines, "", "[names]"), add...)
+	} else {
+		rest := append(add, lines[header+1:]...)
+		lines = append(lines[:header+1], rest...)
+	}
+	return writeFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
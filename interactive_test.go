@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestPromptNames tests prompting for unique names, accepting the suggested
+// name with a blank answer and picking suggestions by number, and prompting
+// again for names that are invalid or already taken.
+func TestPromptNames(t *testing.T) {
+	dups := errDupe{
+		"a":  {"other.com/y/a1", "other.com/y/a2"},
+		"pq": {"github.com/lib/pq", "example.com/pq", "example.org/pq"},
+		"b":  {"other.com/y/b"},
+	}
+	var out bytes.Buffer
+	in := strings.NewReader("\n2\n\nbad/name\na\nb\npq\npostgres\n\n")
+	names, err := promptNames(dups, in, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"other.com/y/a1":    "a",
+		"other.com/y/a2":    "a2",
+		"github.com/lib/pq": "pq",
+		"example.com/pq":    "postgres",
+		"example.org/pq":    "example_org_pq",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("got %v, expected %v", names, expected)
+	}
+	for _, s := range []string{
+		"a found at other.com/y/a1, other.com/y/a2\n",
+		"name for other.com/y/a1 1) a 2) y_a 3) a2 [a] : ",
+		"name for other.com/y/a2 1) y_a 2) a2 [y_a] : ",
+		"name for github.com/lib/pq 1) pq 2) lib_pq 3) pq2 [pq] : ",
+		"invalid name bad/name\n",
+		"name a is already taken\n",
+		"name b is already taken\n",
+		"name pq is already taken\n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("output missing %q, got :\n%s", s, out.String())
+		}
+	}
+	// Running out of input.
+	if _, err := promptNames(dups, strings.NewReader("\n"), ioutil.Discard); err == nil {
+		t.Error("expected error without a choice")
+	}
+}
+
+// TestSaveNames tests saving chosen names into new and existing configuration
+// files, preserving their other settings.
+func TestSaveNames(t *testing.T) {
+	files := []struct {
+		name, src string
+	}{
+		{"", ""},
+		{configJSONName, `{"dir": "lib", "names": {"a/x": "x1", "a/y": "y"}}`},
+		{configTOMLName, "dir = \"lib\"\n\n[names]\n\"a/y\" = \"y\"\n\"a/x\" = \"x1\" # old\n\n[commands.init]\nverbose = true\n"},
+		{configTOMLName, "dir = \"lib\"\n"},
+	}
+	for _, f := range files {
+		dir, err := ioutil.TempDir("", "vend")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if len(f.name) > 0 {
+			if err := ioutil.WriteFile(filepath.Join(dir, f.name), []byte(f.src), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := saveNames(dir, map[string]string{"a/x": "x2", "b/z": "z"}); err != nil {
+			t.Fatalf("%s : %s", f.name, err.Error())
+		}
+		c, err := loadConfig(&build.Default, dir)
+		if err != nil {
+			t.Fatalf("%s : %s", f.name, err.Error())
+		}
+		if c.Names["a/x"] != "x2" || c.Names["b/z"] != "z" {
+			t.Errorf("%q : names not saved, got %v", f.src, c.Names)
+		}
+		if len(f.src) > 0 && c.Dir != filepath.Join(dir, "lib") {
+			t.Errorf("%q : settings lost, got %+v", f.src, c)
+		}
+		if strings.Contains(f.src, "a/y") && c.Names["a/y"] != "y" {
+			t.Errorf("%q : names lost, got %v", f.src, c.Names)
+		}
+		if strings.Contains(f.src, "commands") &&
+			(c.Commands["init"].Verbose == nil || !*c.Commands["init"].Verbose) {
+			t.Errorf("%q : tables lost, got %+v", f.src, c.Commands)
+		}
+	}
+}
+
+// TestSaveNamesTOMLEscapes tests that names saved to a TOML config file with
+// non-ASCII and special characters are read back unchanged.
+func TestSaveNamesTOMLEscapes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, configTOMLName), []byte("dir = \"lib\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]string{
+		"a/ünï":  "名前",
+		"a/q\"x": "tab\tquote\"\\\x01\x7f",
+		"a/😀":    "émoji😀",
+	}
+	if err := saveNames(dir, names); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadConfig(&build.Default, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for imp, name := range names {
+		if c.Names[imp] != name {
+			t.Errorf("%q : expected name %q, got %q", imp, name, c.Names[imp])
+		}
+	}
+}
+
+// TestInitInteractive tests the init subcommand with the interactive option,
+// resolving duplicate package names with the suggested names and saving them.
+func TestInitInteractive(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "init"))
+	defer os.RemoveAll(ctx.GOPATH)
+	in, out, term := promptIn, promptOut, promptTerminal
+	defer func() {
+		opt.interactive = false
+		conf = &config{}
+		promptIn, promptOut, promptTerminal = in, out, term
+	}()
+	opt.interactive = true
+	promptIn, promptOut = strings.NewReader("\n\n"), ioutil.Discard
+	promptTerminal = func() bool { return true }
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "dupe")
+	if err := initc(context.Background(), ctx, pkgDir, "lib", false, false); err != nil {
+		t.Fatalf("error during init : %s", err.Error())
+	}
+	testImports(t, pkgDir,
+		[]string{"example.com/dupe/lib/a", "example.com/dupe/lib/y_a"}, false)
+	c, err := loadConfig(ctx, pkgDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"other.com/y/a1": "a", "other.com/y/a2": "y_a"}
+	if !reflect.DeepEqual(c.Names, expected) {
+		t.Errorf("got saved names %v, expected %v", c.Names, expected)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// errInterrupted is returned when a command is interrupted, lists the work that
+// was done and the work that was not started.
+type errInterrupted struct {
+	done, pending []string
+}
+
+func (e *errInterrupted) Error() string {
+	msg := "interrupted"
+	if len(e.done) > 0 {
+		msg += fmt.Sprintf("\ndone :\n\t%s", strings.Join(e.done, "\n\t"))
+	}
+	if len(e.pending) > 0 {
+		msg += fmt.Sprintf("\nnot done :\n\t%s", strings.Join(e.pending, "\n\t"))
+	}
+	return msg
+}
+
+// interrupted checks whether the `cctx` context is done, if so returns an
+// errInterrupted with the done and pending work.
+func interrupted(cctx context.Context, done, pending []string) error {
+	if cctx.Err() == nil {
+		return nil
+	}
+	return &errInterrupted{done: done, pending: pending}
+}
+
+// wrapInterrupted adds the work done before and the work pending after an
+// operation that returned the error, if it is an errInterrupted, returns any
+// other error as is.
+func wrapInterrupted(err error, done, pending []string) error {
+	ie, ok := err.(*errInterrupted)
+	if !ok {
+		return err
+	}
+	return &errInterrupted{
+		done:    append(append([]string{}, done...), ie.done...),
+		pending: append(append([]string{}, ie.pending...), pending...),
+	}
+}
+
+// interruptContext returns a context that is cancelled on the first interrupt
+// signal, a second interrupt signal kills the process. The returned function
+// stops listening for the signal.
+func interruptContext() (context.Context, func()) {
+	cctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		if _, ok := <-sigs; ok {
+			printErr("Interrupted, finishing the current operation")
+			signal.Stop(sigs)
+			cancel()
+		}
+	}()
+	return cctx, func() {
+		signal.Stop(sigs)
+		close(sigs)
+		cancel()
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countdownContext is a context that is done after its Err method has been
+// called n times.
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+// cancelledContext returns a context that is already done.
+func cancelledContext() context.Context {
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return cctx
+}
+
+// TestPathInterrupted tests that an interrupted recursive path subcommand
+// finishes the current package, and reports the packages that were updated and
+// those that still need to be.
+func TestPathInterrupted(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "update"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	childPkgDir := filepath.Join(pkgDir, "y")
+	cctx := &countdownContext{context.Background(), 1}
+	err := path(cctx, ctx, pkgDir, "go", "mygo", true)
+	ie, ok := err.(*errInterrupted)
+	if !ok {
+		t.Fatalf("expected an interrupted error, got : %v", err)
+	}
+	testStrings(t, "done", ie.done, []string{"updated the imports in " + pkgDir})
+	testStrings(t, "pending", ie.pending, []string{"update the imports in " + childPkgDir})
+	testImports(t, pkgDir,
+		[]string{"fmt", "os", "mygo/ast", "mygo/build", "mygo/parser"},
+		false)
+	testImports(t, childPkgDir,
+		[]string{"fmt", "os", "go/ast", "go/parser"}, false)
+}
+
+// TestCpInterrupted tests that an interrupted cp subcommand leaves neither the
+// destination nor temporary directories behind.
+func TestCpInterrupted(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	libDir := filepath.Join(pkgDir, "lib")
+	dstDir := filepath.Join(libDir, "y")
+	err := cp(cancelledContext(), ctx, pkgDir, "other.com/y", dstDir, false, false)
+	ie, ok := err.(*errInterrupted)
+	if !ok {
+		t.Fatalf("expected an interrupted error, got : %v", err)
+	}
+	if len(ie.done) > 0 {
+		t.Errorf("expected nothing done, got %v", ie.done)
+	}
+	testStrings(t, "pending", ie.pending, []string{"copy other.com/y to " + dstDir})
+	testExists(t, dstDir, false)
+	if fis, err := ioutil.ReadDir(libDir); err == nil && len(fis) > 0 {
+		t.Errorf("expected no temporary directories in %s, found %s", libDir, fis[0].Name())
+	}
+	testImports(t, pkgDir, []string{"other.com/y"}, false)
+}
+
+// TestInitInterrupted tests that an interrupted init subcommand lists the
+// copies that were not made.
+func TestInitInterrupted(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "init"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	err := initc(cancelledContext(), ctx, pkgDir, "lib", false, false)
+	ie, ok := err.(*errInterrupted)
+	if !ok {
+		t.Fatalf("expected an interrupted error, got : %v", err)
+	}
+	if len(ie.done) > 0 {
+		t.Errorf("expected nothing done, got %v", ie.done)
+	}
+	testStrings(t, "pending", ie.pending, []string{
+		"copy other.com/y/a1 to " + filepath.Join(pkgDir, "lib", "a"),
+		"copy other.com/y/b to " + filepath.Join(pkgDir, "lib", "b"),
+	})
+	testExists(t, filepath.Join(pkgDir, "lib"), false)
+}
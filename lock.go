@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockFile is the name of the file, in the project's directory, held by the
+// process running a command that makes changes to the project.
+const lockFile = ".vend.lock"
+
+// lockPoll is how often a held lock is checked when waiting for it.
+var lockPoll = 100 * time.Millisecond
+
+// lockGrace is how long a lock file without a process identifier, still being
+// written or left behind by a crash, is considered held.
+var lockGrace = 5 * time.Second
+
+// lockPath is the path of the lock file held by the command, empty if none.
+var lockPath string
+
+// errLocked is returned when the project is locked by another process.
+type errLocked struct {
+	// path is the path of the lock file.
+	path string
+	// pid is the process identifier of the holding process, zero if it is
+	// not known yet.
+	pid int
+}
+
+func (e errLocked) Error() string {
+	holder := "another process"
+	if e.pid > 0 {
+		holder = fmt.Sprintf("process %d", e.pid)
+	}
+	return fmt.Sprintf("project is locked by %s through %s, run with -wait to wait for it",
+		holder, e.path)
+}
+
+// lock takes the advisory lock on the project in the `dir` directory, by
+// creating its lock file holding the process identifier, released by unlock.
+// Lock files left behind by processes that are no longer running are removed,
+// on a best effort basis as the check and the removal are not atomic.
+// With the opt.wait option set waits for the lock to be released, until the
+// `cctx` context is done, otherwise returns an errLocked.
+func lock(cctx context.Context, dir string) error {
+	path := filepath.Join(dir, lockFile)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return err
+			}
+			lockPath = path
+			return nil
+		} else if !os.IsExist(err) {
+			return err
+		}
+		pid, stale, err := readLock(path)
+		if err != nil {
+			return err
+		} else if stale {
+			if opt.verbose {
+				fmt.Printf("removing stale lock %s\n", path)
+			}
+			// Skip removing the lock if it was taken in the meantime, a
+			// lock taken between this check and the removal is still
+			// removed, leaving a narrow window for two holders.
+			if p, _, err := readLock(path); err == nil && p == pid {
+				os.Remove(path)
+			}
+			continue
+		} else if !opt.wait {
+			return errLocked{path, pid}
+		}
+		select {
+		case <-cctx.Done():
+			return &errInterrupted{pending: []string{"wait for " + path}}
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+// readLock reads the process identifier held in the lock file at the `path`,
+// and whether the lock is stale, its process no longer running.
+// A lock that was released is stale.
+func readLock(path string) (pid int, stale bool, err error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, true, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, true, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	if pid, err = strconv.Atoi(strings.TrimSpace(string(b))); err != nil || pid <= 0 {
+		return 0, time.Since(info.ModTime()) > lockGrace, nil
+	}
+	return pid, !processRunning(pid), nil
+}
+
+// unlock releases the lock taken by lock, if any.
+func unlock() error {
+	if len(lockPath) == 0 {
+		return nil
+	}
+	err := os.Remove(lockPath)
+	lockPath = ""
+	return err
+}
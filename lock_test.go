@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLockDir creates a temporary project directory, resets the held lock
+// once the test is done.
+func testLockDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "vend-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		lockPath = ""
+		opt.wait = false
+		os.RemoveAll(dir)
+	}
+}
+
+// TestLock tests that the lock holds the process identifier, that it cannot be
+// taken twice, and that it is released.
+func TestLock(t *testing.T) {
+	dir, done := testLockDir(t)
+	defer done()
+	path := filepath.Join(dir, lockFile)
+	if err := lock(context.Background(), dir); err != nil {
+		t.Fatalf("lock error : %s", err.Error())
+	}
+	testLockHolder(t, path, os.Getpid())
+	err := lock(context.Background(), dir)
+	if le, ok := err.(errLocked); !ok || le.pid != os.Getpid() {
+		t.Fatalf("expected the lock to be held by this process, got : %v", err)
+	} else if !strings.Contains(err.Error(), fmt.Sprint(os.Getpid())) {
+		t.Errorf("error does not name the holding process : %s", err.Error())
+	}
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock error : %s", err.Error())
+	}
+	testExists(t, path, false)
+}
+
+// TestLockStale tests that a lock left behind by a process that is no longer
+// running is taken over.
+func TestLockStale(t *testing.T) {
+	dir, done := testLockDir(t)
+	defer done()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, lockFile)
+	stale := fmt.Sprintf("%d\n", cmd.Process.Pid)
+	if err := ioutil.WriteFile(path, []byte(stale), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock(context.Background(), dir); err != nil {
+		t.Fatalf("lock error : %s", err.Error())
+	}
+	testLockHolder(t, path, os.Getpid())
+}
+
+// TestLockWait tests that with the wait option the lock is taken once it is
+// released, or until the context is done.
+func TestLockWait(t *testing.T) {
+	dir, done := testLockDir(t)
+	defer done()
+	opt.wait = true
+	path := filepath.Join(dir, lockFile)
+	held := fmt.Sprintf("%d\n", os.Getpid())
+	if err := ioutil.WriteFile(path, []byte(held), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cctx, cancel := context.WithTimeout(context.Background(), 3*lockPoll)
+	defer cancel()
+	if err := lock(cctx, dir); err == nil {
+		t.Fatal("expected the lock to still be held")
+	} else if _, ok := err.(*errInterrupted); !ok {
+		t.Fatalf("expected an interrupted error, got : %s", err.Error())
+	}
+	go func() {
+		time.Sleep(2 * lockPoll)
+		os.Remove(path)
+	}()
+	if err := lock(context.Background(), dir); err != nil {
+		t.Fatalf("lock error : %s", err.Error())
+	}
+	if lockPath != path {
+		t.Errorf("expected the lock to be held at %s", path)
+	}
+}
+
+// testLockHolder tests that the lock file at the `path` holds the `pid` process
+// identifier.
+func testLockHolder(t *testing.T, path string, pid int) {
+	got, err := getFileContents(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(got) != fmt.Sprintf("%d\n", pid) {
+		t.Errorf("lock file holds %q, expected process %d", got, pid)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import "os"
+
+// processRunning checks whether a process with the `pid` process identifier is
+// running, finding a process opens it, which fails once it has exited.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
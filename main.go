@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"go/build"
 	"os"
+	"os/exec"
 )
 
 // main parses arguments and flags and passes the arguments to the correct
@@ -21,6 +23,26 @@ func main() {
 		}
 		ctx := &build.Default
 		ctx.UseAllFiles = true
+		if conf, err = loadConfig(ctx, cwd); err != nil {
+			printErr("Error : " + err.Error())
+			os.Exit(1)
+		}
+		// The project lock is taken in the project's root directory, so
+		// commands run from its subdirectories exclude each other.
+		root := projectRoot(ctx, cwd)
+		if f, ok := flagMap[os.Args[1]]; ok && os.Args[1] != "main" {
+			if err = conf.seedFlags(os.Args[1], f); err != nil {
+				printErr("Error : " + err.Error())
+				os.Exit(1)
+			}
+		}
+		// Commands that make changes over many packages finish the
+		// current operation and stop on interrupt.
+		cctx, stop := context.Background(), func() {}
+		switch os.Args[1] {
+		case "init", "cp", "mv", "get", "path":
+			cctx, stop = interruptContext()
+		}
 		switch os.Args[1] {
 		case "list":
 			f := flagMap["list"]
@@ -42,21 +64,42 @@ func main() {
 				path = "."
 			}
 			err = info(ctx, cwd, path)
+		case "why":
+			f := flagMap["why"]
+			f.Parse(os.Args[2:])
+			if len(f.Args()) > 0 {
+				err = why(ctx, cwd, f.Arg(0), os.Stdout)
+			} else {
+				printErr("Missing argument")
+				f.Usage()
+				os.Exit(1)
+			}
 		case "init":
 			f := flagMap["init"]
 			f.Parse(os.Args[2:])
+			var dst string
 			if len(f.Args()) > 0 {
-				err = initc(ctx, cwd, f.Arg(0), opt.recurse, opt.hidden)
+				dst = f.Arg(0)
+			} else if len(conf.Dir) > 0 {
+				dst = conf.Dir
 			} else {
 				printErr("Missing argument")
 				f.Usage()
 				os.Exit(1)
 			}
+			if err = lock(cctx, root); err == nil {
+				err = initc(cctx, ctx, cwd, dst, opt.recurse, opt.hidden)
+			}
 		case "cp":
 			f := flagMap["cp"]
 			f.Parse(os.Args[2:])
 			if len(f.Args()) > 1 {
-				err = cp(ctx, cwd, f.Arg(0), f.Arg(1), opt.recurse, opt.hidden)
+				if err = lock(cctx, root); err == nil {
+					err = checkCycle(ctx, cwd, f.Arg(0), f.Arg(1), opt.recurse, true, false)
+				}
+				if err == nil {
+					err = cp(cctx, ctx, cwd, f.Arg(0), f.Arg(1), opt.recurse, opt.hidden)
+				}
 			} else {
 				printErr("Missing arguments")
 				f.Usage()
@@ -66,8 +109,14 @@ func main() {
 			f := flagMap["mv"]
 			f.Parse(os.Args[2:])
 			if len(f.Args()) > 1 {
-				err = mv(ctx, cwd, f.Arg(0), f.Arg(1), opt.recurse, opt.hidden)
+				if err = lock(cctx, root); err == nil {
+					err = checkCycle(ctx, cwd, f.Arg(0), f.Arg(1), opt.recurse, true, true)
+				}
+				if err == nil {
+					err = mv(cctx, ctx, cwd, f.Arg(0), f.Arg(1), opt.recurse, opt.hidden)
+				}
 				if err == ErrStandardPackage {
+					unlock()
 					printErr("Cannot move standard package")
 					f.Usage()
 					os.Exit(1)
@@ -77,27 +126,183 @@ func main() {
 				f.Usage()
 				os.Exit(1)
 			}
+		case "get":
+			f := flagMap["get"]
+			f.Parse(os.Args[2:])
+			if len(f.Args()) > 2 {
+				if err = lock(cctx, root); err == nil {
+					err = get(cctx, ctx, cwd, f.Arg(0), f.Arg(1), f.Arg(2), opt.recurse, opt.hidden)
+				}
+			} else {
+				printErr("Missing arguments")
+				f.Usage()
+				os.Exit(1)
+			}
 		case "path":
 			f := flagMap["path"]
 			f.Parse(os.Args[2:])
 			if len(f.Args()) > 1 {
-				err = path(ctx, cwd, f.Arg(0), f.Arg(1), opt.recurse)
+				if err = lock(cctx, root); err == nil {
+					err = checkCycle(ctx, cwd, f.Arg(0), f.Arg(1), opt.recurse, false, false)
+				}
+				if p := checkRewrite(ctx, cwd, opt.recurse, f.Arg(0)); err == nil && len(p) > 0 {
+					err = p
+				} else if err == nil {
+					err = path(cctx, ctx, cwd, f.Arg(0), f.Arg(1), opt.recurse)
+				}
 			} else {
 				printErr("Missing arguments")
 				f.Usage()
 				os.Exit(1)
 			}
+		case "prune":
+			f := flagMap["prune"]
+			f.Parse(os.Args[2:])
+			var dir string
+			if len(f.Args()) > 0 {
+				dir = f.Arg(0)
+			} else if len(conf.Dir) > 0 {
+				dir = conf.Dir
+			} else {
+				dir = "."
+			}
+			// Only removing the unused packages makes changes.
+			if opt.force {
+				err = lock(cctx, root)
+			}
+			if err == nil {
+				err = prune(ctx, cwd, dir)
+			}
+		case "verify":
+			f := flagMap["verify"]
+			f.Parse(os.Args[2:])
+			var dir string
+			if len(f.Args()) > 0 {
+				dir = f.Arg(0)
+			} else if len(conf.Dir) > 0 {
+				dir = conf.Dir
+			} else {
+				dir = "."
+			}
+			// Only accepting the changes makes changes.
+			if opt.update {
+				err = lock(cctx, root)
+			}
+			if err == nil {
+				err = verify(cwd, dir)
+			}
+		case "diff":
+			f := flagMap["diff"]
+			f.Parse(os.Args[2:])
+			if len(f.Args()) > 0 {
+				err = diff(ctx, cwd, f.Arg(0), f.Arg(1))
+			} else {
+				printErr("Missing argument")
+				f.Usage()
+				os.Exit(1)
+			}
+		case "patch":
+			f := flagMap["patch"]
+			f.Parse(os.Args[2:])
+			if len(f.Args()) < 2 {
+				printErr("Missing arguments")
+				f.Usage()
+				os.Exit(1)
+			}
+			switch f.Arg(0) {
+			case "save", "apply":
+			default:
+				printErr("Invalid patch action : " + f.Arg(0))
+				f.Usage()
+				os.Exit(1)
+			}
+			if err = lock(cctx, root); err != nil {
+				break
+			} else if f.Arg(0) == "save" {
+				err = patchSave(ctx, root, cwd, f.Arg(1))
+			} else {
+				err = patchApply(root, cwd, f.Arg(1))
+			}
+		case "status":
+			f := flagMap["status"]
+			f.Parse(os.Args[2:])
+			var dir string
+			if len(f.Args()) > 0 {
+				dir = f.Arg(0)
+			} else if len(conf.Dir) > 0 {
+				dir = conf.Dir
+			} else {
+				dir = "."
+			}
+			err = status(ctx, cwd, dir)
+		case "check":
+			f := flagMap["check"]
+			f.Parse(os.Args[2:])
+			var dir string
+			if len(f.Args()) > 0 {
+				dir = f.Arg(0)
+			} else if len(conf.Dir) > 0 {
+				dir = conf.Dir
+			} else {
+				dir = "."
+			}
+			// Only fixing the leaking imports makes changes.
+			if opt.fix {
+				err = lock(cctx, root)
+			}
+			if err == nil {
+				err = check(ctx, cwd, dir)
+			}
+		case "completion":
+			f := flagMap["completion"]
+			f.Parse(os.Args[2:])
+			if len(f.Args()) > 0 {
+				err = completion(ctx, cwd, os.Stdout, f.Args())
+			} else {
+				printErr("Missing argument")
+				f.Usage()
+				os.Exit(1)
+			}
 		case "-h":
 			flagMap["main"].Usage()
 		default:
-			printErr("Invalid subcommand : " + os.Args[1])
-			flagMap["main"].Usage()
-			os.Exit(1)
+			// Look for a plugin providing the subcommand.
+			var found bool
+			if found, err = runPlugin(ctx, cwd, os.Args[1], os.Args[2:]); !found {
+				printErr("Invalid subcommand : " + os.Args[1])
+				flagMap["main"].Usage()
+				os.Exit(1)
+			} else if ee, ok := err.(*exec.ExitError); ok {
+				// The plugin reported its own errors.
+				os.Exit(ee.ExitCode())
+			}
 		}
+		stop()
 	}
-	// Output errors and exit
-	if err != nil {
+	// Output errors and exit, restoring the directories replaced or removed
+	// and the files rewritten by a failed command, an interrupted command
+	// keeps the completed work.
+	// The project lock is held until then.
+	code := 0
+	if ie, ok := err.(*errInterrupted); ok {
+		if cerr := commitBackups(); cerr != nil {
+			printErr("Error removing backups : " + cerr.Error())
+		}
+		printErr("Error : " + ie.Error())
+		code = 1
+	} else if err != nil {
+		if rerr := restoreBackups(); rerr != nil {
+			printErr("Error restoring backups : " + rerr.Error())
+		}
 		printErr("Error : " + err.Error())
-		os.Exit(1)
+		code = 1
+	} else if err = commitBackups(); err != nil {
+		printErr("Error removing backups : " + err.Error())
+		code = 1
+	}
+	if err := unlock(); err != nil {
+		printErr("Error removing lock : " + err.Error())
+		code = 1
 	}
+	os.Exit(code)
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// mergeImports merges the import specs of the parsed file, with the source src,
+// that import the same path, np, once rewritten. A single spec is kept,
+// preferring one that imports np already and is not a blank import, the others
+// are removed.
+// When a removed spec is named differently from the kept spec, the qualified
+// identifiers using its name are updated to the name of the kept spec.
+// Returns the edits to apply to the source, the removed specs, and an error
+// with the position of the conflict if the imports cannot be merged.
+func (r *rewriter) mergeImports(fs *token.FileSet, f *ast.File, src []byte, np string, specs []*ast.ImportSpec) ([]edit, []*ast.ImportSpec, error) {
+	specName := func(is *ast.ImportSpec) string {
+		if is.Name != nil {
+			return is.Name.Name
+		}
+		return r.pkgName(specPath(is))
+	}
+	// Choose the spec to keep.
+	keep := specs[0]
+	for _, is := range specs {
+		if specName(is) == "_" {
+			continue
+		}
+		if specName(keep) == "_" ||
+			(specPath(is) == np && specPath(keep) != np) {
+			keep = is
+		}
+	}
+	keepName := r.finalName(keep, np)
+	edits := make([]edit, 0)
+	removed := make([]*ast.ImportSpec, 0)
+	for _, is := range specs {
+		if is == keep {
+			continue
+		}
+		isName := specName(is)
+		switch {
+		case isName == "_" || isName == keepName:
+		case isName == "." || keepName == ".":
+			return nil, nil, fmt.Errorf("%s: cannot merge import of %q named %s with the import named %s at %s",
+				fs.Position(is.Pos()), np, isName, keepName, fs.Position(keep.Pos()))
+		default:
+			if pos := findDecl(f, keepName); pos.IsValid() {
+				return nil, nil, fmt.Errorf("%s: cannot merge import of %q named %s into the import named %s, %s is declared at %s",
+					fs.Position(is.Pos()), np, isName, keepName, keepName, fs.Position(pos))
+			}
+			edits = append(edits, renameSelectors(fs, f, isName, keepName)...)
+		}
+		edits = append(edits, removeSpec(fs, f, src, is))
+		removed = append(removed, is)
+	}
+	return edits, removed, nil
+}
+
+// findDecl finds the position of a declaration of the name in the file, either
+// at the top level or in a local scope where it is used. Returns an invalid
+// position if the name is not declared.
+func findDecl(f *ast.File, name string) (pos token.Pos) {
+	if obj := f.Scope.Lookup(name); obj != nil {
+		return obj.Pos()
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == name && id.Obj != nil {
+			pos = id.Obj.Pos()
+		}
+		return !pos.IsValid()
+	})
+	return pos
+}
+
+// renameSelectors compiles the edits that rename the package name of all the
+// qualified identifiers in the file using the `from` package name to the `to`
+// package name. Identifiers referring to local declarations are skipped.
+func renameSelectors(fs *token.FileSet, f *ast.File, from, to string) []edit {
+	edits := make([]edit, 0)
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok && id.Name == from && id.Obj == nil {
+			edits = append(edits, edit{
+				fs.Position(id.Pos()).Offset,
+				fs.Position(id.End()).Offset,
+				to,
+			})
+		}
+		return true
+	})
+	return edits
+}
+
+// removeSpec compiles the edit that removes the import spec, along with its
+// comments, from the parsed file with the source src. The whole line is removed
+// when nothing else is on it, and the whole declaration when it is not
+// parenthesized.
+func removeSpec(fs *token.FileSet, f *ast.File, src []byte, is *ast.ImportSpec) edit {
+	start, end := is.Pos(), is.End()
+	if is.Doc != nil {
+		start = is.Doc.Pos()
+	}
+	if is.Comment != nil {
+		end = is.Comment.End()
+	}
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if ok && gen.Tok == token.IMPORT && !gen.Lparen.IsValid() &&
+			len(gen.Specs) == 1 && gen.Specs[0] == is {
+			start = gen.Pos()
+			if gen.Doc != nil {
+				start = gen.Doc.Pos()
+			}
+		}
+	}
+	s, e := fs.Position(start).Offset, fs.Position(end).Offset
+	isSpace := func(b byte) bool { return b == ' ' || b == '\t' || b == '\r' }
+	// Include a following semicolon and the surrounding whitespace.
+	for e < len(src) && isSpace(src[e]) {
+		e++
+	}
+	if e < len(src) && src[e] == ';' {
+		e++
+		for e < len(src) && isSpace(src[e]) {
+			e++
+		}
+	}
+	ls := s
+	for ls > 0 && isSpace(src[ls-1]) {
+		ls--
+	}
+	if (ls == 0 || src[ls-1] == '\n') && (e == len(src) || src[e] == '\n') {
+		if e < len(src) {
+			e++
+		}
+		return edit{ls, e, ""}
+	}
+	return edit{s, e, ""}
+}
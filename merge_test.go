@@ -0,0 +1,144 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	pathpkg "path"
+	"strings"
+	"testing"
+)
+
+// mergeImportsTests holds table tests for merging duplicate imports created by
+// rewriting the import path "a/x" to "b/x".
+var mergeImportsTests = []struct {
+	src string
+	out string
+	err string // expected prefix of the error
+}{
+	{
+		// Both unnamed.
+		"package p\n\nimport (\n\t\"a/x\"\n\t\"b/x\"\n)\n\nvar _ = x.A\n",
+		"package p\n\nimport (\n\t\"b/x\"\n)\n\nvar _ = x.A\n",
+		"",
+	},
+	{
+		// Separate declarations without parentheses.
+		"package p\n\nimport \"b/x\"\nimport \"a/x\"\n\nvar _ = x.A\n",
+		"package p\n\nimport \"b/x\"\n\nvar _ = x.A\n",
+		"",
+	},
+	{
+		// Different names, qualified identifiers updated.
+		"package p\n\nimport (\n\tax \"a/x\" // old\n\t\"b/x\"\n)\n\nvar _ = ax.A + x.B\n",
+		"package p\n\nimport (\n\t\"b/x\"\n)\n\nvar _ = x.A + x.B\n",
+		"",
+	},
+	{
+		// Blank import removed.
+		"package p\n\nimport (\n\t_ \"a/x\"; bx \"b/x\"\n)\n\nvar _ = bx.A\n",
+		"package p\n\nimport (\n\tbx \"b/x\"\n)\n\nvar _ = bx.A\n",
+		"",
+	},
+	{
+		// Name of the kept import is shadowed.
+		"package p\n\nimport (\n\tax \"a/x\"\n\t\"b/x\"\n)\n\nfunc f() { x := ax.A; _ = x }\n",
+		"",
+		"x.go:4:2: cannot merge import of \"b/x\" named ax into the import named x, x is declared at x.go:8:12",
+	},
+}
+
+// TestMergeImports tests rewriting imports that become duplicates.
+func TestMergeImports(t *testing.T) {
+	r := &rewriter{
+		rw:   map[string]string{"a/x": "b/x"},
+		name: pathpkg.Base,
+	}
+	for _, tt := range mergeImportsTests {
+		fs := token.NewFileSet()
+		f, err := parser.ParseFile(fs, "x.go", tt.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _, err := r.rwImports(fs, f, []byte(tt.src))
+		switch {
+		case len(tt.err) > 0 && (err == nil || !strings.HasPrefix(err.Error(), tt.err)):
+			t.Errorf("merging %q : got error %v, expected %s", tt.src, err, tt.err)
+		case len(tt.err) == 0 && err != nil:
+			t.Errorf("merging %q : unexpected error %s", tt.src, err.Error())
+		case len(tt.err) == 0 && string(out) != tt.out:
+			t.Errorf("merging %q : got %q, expected %q", tt.src, out, tt.out)
+		}
+	}
+}
+
+// renameImportsTests holds table tests for rewriting the import path "a/x",
+// of the package named x, to "b/y", of the package named y.
+var renameImportsTests = []struct {
+	selectors bool
+	src       string
+	out       string
+	err       string // expected prefix of the error
+}{
+	{
+		// Unnamed import aliased with the old package name.
+		false,
+		"package p\n\nimport \"a/x\"\n\nvar _ = x.A\n",
+		"package p\n\nimport x \"b/y\"\n\nvar _ = x.A\n",
+		"",
+	},
+	{
+		// Named import left alone.
+		false,
+		"package p\n\nimport ax \"a/x\"\n\nvar _ = ax.A\n",
+		"package p\n\nimport ax \"b/y\"\n\nvar _ = ax.A\n",
+		"",
+	},
+	{
+		// Qualified identifiers renamed, locals skipped.
+		true,
+		"package p\n\nimport \"a/x\"\n\nvar _ = x.A\n\nfunc f(x struct{ A int }) { _ = x.A }\n",
+		"package p\n\nimport \"b/y\"\n\nvar _ = y.A\n\nfunc f(x struct{ A int }) { _ = x.A }\n",
+		"",
+	},
+	{
+		// New package name is already declared.
+		true,
+		"package p\n\nimport \"a/x\"\n\nvar y = x.A\n",
+		"",
+		"x.go:3:8: cannot rename qualified identifiers of \"b/y\" from x to y, y is declared at x.go:5:5",
+	},
+	{
+		// Merged into an existing import of the new path, which keeps its
+		// own name.
+		false,
+		"package p\n\nimport (\n\t\"a/x\"\n\t\"b/y\"\n)\n\nvar _ = x.A + y.B\n",
+		"package p\n\nimport (\n\t\"b/y\"\n)\n\nvar _ = y.A + y.B\n",
+		"",
+	},
+}
+
+// TestRenameImports tests rewriting imports whose package name changes.
+func TestRenameImports(t *testing.T) {
+	names := map[string]string{"a/x": "x", "b/y": "y"}
+	for _, tt := range renameImportsTests {
+		r := &rewriter{
+			rw:        map[string]string{"a/x": "b/y"},
+			name:      func(imp string) string { return names[imp] },
+			selectors: tt.selectors,
+		}
+		fs := token.NewFileSet()
+		f, err := parser.ParseFile(fs, "x.go", tt.src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _, err := r.rwImports(fs, f, []byte(tt.src))
+		switch {
+		case len(tt.err) > 0 && (err == nil || !strings.HasPrefix(err.Error(), tt.err)):
+			t.Errorf("rewriting %q : got error %v, expected %s", tt.src, err, tt.err)
+		case len(tt.err) == 0 && err != nil:
+			t.Errorf("rewriting %q : unexpected error %s", tt.src, err.Error())
+		case len(tt.err) == 0 && string(out) != tt.out:
+			t.Errorf("rewriting %q : got %q, expected %q", tt.src, out, tt.out)
+		}
+	}
+}
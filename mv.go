@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"go/build"
-	"os"
+	"path/filepath"
 )
 
 // ErrStandardPackage is returned when a subcommand is attempted on a standard
@@ -13,8 +15,10 @@ var ErrStandardPackage = errors.New("standard package specified")
 // mv moves the package at the specified path to the specified destination
 // directory.
 // Just like cp, but cannot be used with standard packages and removes the
-// source directory afterwards.
-func mv(ctx *build.Context, cwd, src, dst string, recurse, hidden bool) (err error) {
+// source directory afterwards, by moving it into a backup, validates that it
+// can be removed before making any changes.
+// Once the `cctx` context is done the source is kept, see cp.
+func mv(cctx context.Context, ctx *build.Context, cwd, src, dst string, recurse, hidden bool) (err error) {
 	// Ignore the error because the directory itself might not be a package
 	// but may contain subdirectories that do, all we want to know here is
 	// if it is in the GOROOT.
@@ -22,8 +26,18 @@ func mv(ctx *build.Context, cwd, src, dst string, recurse, hidden bool) (err err
 	if srcPkg.Goroot {
 		return ErrStandardPackage
 	}
-	if err := cp(ctx, cwd, src, dst, recurse, hidden); err != nil {
-		return err
+	// Validate before making any changes, along with the copy so every
+	// problem is reported at once.
+	if len(srcPkg.Dir) > 0 && !dirWritable(filepath.Dir(srcPkg.Dir)) {
+		p := errPreflight{fmt.Sprintf("directory %s is not writable, can't remove the source",
+			filepath.Dir(srcPkg.Dir))}
+		if abs, err := cwdAbs(cwd, dst); err == nil {
+			p = append(p, checkCopy(ctx, cwd, srcPkg.ImportPath, srcPkg.Dir, abs, recurse)...)
+		}
+		return p
 	}
-	return os.RemoveAll(srcPkg.Dir)
+	if err := cp(cctx, ctx, cwd, src, dst, recurse, hidden); err != nil {
+		return wrapInterrupted(err, nil, []string{"remove " + srcPkg.Dir})
+	}
+	return backupDir(srcPkg.Dir)
 }
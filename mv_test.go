@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -12,7 +13,7 @@ func TestMv(t *testing.T) {
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
 	srcDir := filepath.Join(ctx.GOPATH, "src", "other.com", "y")
-	err := mv(ctx, pkgDir, "other.com/y", "lib/y", false, false)
+	err := mv(context.Background(), ctx, pkgDir, "other.com/y", "lib/y", false, false)
 	if err != nil {
 		t.Errorf("error during mv : %s", err.Error())
 	}
@@ -29,7 +30,7 @@ func TestMvStandardPackage(t *testing.T) {
 	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
-	err := mv(ctx, pkgDir, "fmt", "lib/fmt", false, false)
+	err := mv(context.Background(), ctx, pkgDir, "fmt", "lib/fmt", false, false)
 	if err != ErrStandardPackage {
 		t.Errorf("moving standard package err : got %v, expected %v",
 			err, ErrStandardPackage)
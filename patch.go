@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// patchDir is the directory, in the project's root directory, where patches
+// for copied packages are saved.
+const patchDir = "patches"
+
+// patchSave runs the patch save subcommand, saves the modifications made to
+// the copied package located in the `dir` directory, relative to the current
+// working directory, as a unified diff from its upstream package, see diff, to
+// a patch file in the patches directory of the project in the `root`
+// directory, see patchFile. Removes the patch file if there are no
+// modifications.
+func patchSave(ctx *build.Context, root, cwd, dir string) error {
+	name, err := patchFile(root, cwd, dir)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	found, err := diffPackage(ctx, cwd, dir, "", &buf)
+	if err != nil {
+		return err
+	}
+	if !found {
+		fmt.Printf("no modifications in %s\n", dir)
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	fps, err := parsePatch(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	for _, fp := range fps {
+		if fp.binary {
+			return fmt.Errorf("cannot save binary changes to %s", fp.name())
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if opt.verbose {
+		fmt.Printf("saving %d changed files to %s\n", len(fps), name)
+	}
+	return writeFile(name, buf.Bytes(), 0644)
+}
+
+// patchApply runs the patch apply subcommand, applies the patch file saved for
+// the copied package located in the `dir` directory, see patchSave.
+// Hunks are located at the line numbers in their headers, or the nearest
+// position where their context matches. If any hunk fails no files are
+// changed, and the failing hunks are reported along with the context they
+// expected.
+// Updates the digests recorded in the copy to accept the patched files.
+func patchApply(root, cwd, dir string) error {
+	name, err := patchFile(root, cwd, dir)
+	if err != nil {
+		return err
+	}
+	if dir, err = cwdAbs(cwd, dir); err != nil {
+		return err
+	}
+	src, err := getFileContents(name)
+	if err != nil {
+		return err
+	}
+	fps, err := parsePatch(src)
+	if err != nil {
+		return fmt.Errorf("%s : %s", name, err.Error())
+	}
+	// Compute all the results before writing any.
+	type result struct {
+		path   string
+		out    []byte
+		remove bool
+	}
+	results := make([]result, 0, len(fps))
+	failed := make(errHunks, 0)
+	for _, fp := range fps {
+		path := filepath.Join(dir, filepath.FromSlash(fp.name()))
+		if fp.binary {
+			return fmt.Errorf("cannot apply binary changes to %s", fp.name())
+		}
+		var cur []byte
+		if fp.oldName != "/dev/null" {
+			if cur, err = getFileContents(path); err != nil {
+				return err
+			}
+		} else if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("cannot create %s, already exists", fp.name())
+		}
+		out, errs := fp.apply(cur)
+		if len(errs) > 0 {
+			failed = append(failed, errs...)
+			continue
+		}
+		results = append(results, result{path, out, fp.newName == "/dev/null"})
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	for _, r := range results {
+		if opt.verbose {
+			fmt.Printf("patching %s\n", r.path)
+		}
+		if r.remove {
+			err = os.Remove(r.path)
+		} else if err = os.MkdirAll(filepath.Dir(r.path), 0755); err == nil {
+			err = writeFile(r.path, r.out, 0644)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Accept the patched files.
+	if !hasRecord(dir) {
+		return nil
+	}
+	rec, err := readRecord(dir)
+	if err != nil {
+		return err
+	}
+	if rec.Files, err = hashDir(dir); err != nil {
+		return err
+	}
+	return writeRecord(dir, rec)
+}
+
+// patchFile returns the path of the patch file for the copied package located
+// in the `dir` directory, relative to the current working directory, in the
+// patches directory of the project in the `root` directory, named after the
+// path of the copy relative to it. The copy must be located in the project.
+func patchFile(root, cwd, dir string) (string, error) {
+	dir, err := cwdAbs(cwd, dir)
+	if err != nil {
+		return "", err
+	}
+	if !isChildDir(root, dir) {
+		return "", fmt.Errorf("%s is not located in %s", dir, root)
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, patchDir, rel+".patch"), nil
+}
+
+// filePatch holds the changes to a single file in a unified diff.
+type filePatch struct {
+	// oldName and newName are the names in the header, /dev/null if the
+	// file is created or removed.
+	oldName, newName string
+	// binary is whether the file is binary, without any hunks.
+	binary bool
+	hunks  []*hunk
+}
+
+// name returns the slash separated path of the file, relative to the directory
+// the patch applies to, stripping the a/ and b/ prefixes.
+func (fp *filePatch) name() string {
+	if fp.newName != "/dev/null" {
+		return strings.TrimPrefix(fp.newName, "b/")
+	}
+	return strings.TrimPrefix(fp.oldName, "a/")
+}
+
+// hunk holds a set of changed lines and their context in a unified diff.
+type hunk struct {
+	// oldStart and newStart are the line numbers from the header, the
+	// counts are the number of lines in the old and new versions.
+	oldStart, oldCount, newStart, newCount int
+	// header is the header line of the hunk.
+	header string
+	lines  []diffLine
+}
+
+// parsePatch parses the unified diff into the changes to each file.
+func parsePatch(src []byte) ([]*filePatch, error) {
+	fps := make([]*filePatch, 0)
+	lines := splitLines(src)
+	var fp *filePatch
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		lineErr := func(msg string) error {
+			return fmt.Errorf("line %d : %s", i+1, msg)
+		}
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+				return nil, lineErr("expected +++ header")
+			}
+			i++
+			fp = &filePatch{
+				oldName: strings.TrimSpace(line[4:]),
+				newName: strings.TrimSpace(strings.TrimRight(lines[i], "\r\n")[4:]),
+			}
+			fps = append(fps, fp)
+		case strings.HasPrefix(line, "Binary files "):
+			names := strings.TrimSuffix(strings.TrimPrefix(line, "Binary files "), " differ")
+			parts := strings.SplitN(names, " and ", 2)
+			if len(parts) != 2 {
+				return nil, lineErr("invalid binary files line")
+			}
+			fps = append(fps, &filePatch{oldName: parts[0], newName: parts[1], binary: true})
+			fp = nil
+		case strings.HasPrefix(line, "@@ "):
+			if fp == nil {
+				return nil, lineErr("hunk without a file header")
+			}
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, lineErr(err.Error())
+			}
+			fp.hunks = append(fp.hunks, h)
+			// Read the lines of the hunk, as counted in the header.
+			for old, new := 0, 0; old < h.oldCount || new < h.newCount; {
+				if i++; i >= len(lines) {
+					return nil, fmt.Errorf("truncated hunk %s in %s", h.header, fp.name())
+				}
+				var op diffOp
+				text := lines[i]
+				switch text[0] {
+				case ' ':
+					op, text = diffEqual, text[1:]
+				case '-':
+					op, text = diffDelete, text[1:]
+				case '+':
+					op, text = diffInsert, text[1:]
+				case '\n', '\r':
+					// Some editors strip the space from empty
+					// context lines.
+					op = diffEqual
+				default:
+					return nil, lineErr(fmt.Sprintf("invalid hunk line %q", strings.TrimRight(text, "\r\n")))
+				}
+				h.lines = append(h.lines, diffLine{op, text})
+				if old, new = diffAdvance(op, old, new); old > h.oldCount || new > h.newCount {
+					return nil, lineErr("hunk longer than its header")
+				}
+				if i+1 < len(lines) && strings.HasPrefix(lines[i+1], `\`) {
+					// No newline at the end of the file.
+					i++
+					last := &h.lines[len(h.lines)-1]
+					last.text = strings.TrimSuffix(last.text, "\n")
+				}
+			}
+		}
+		// Anything else between files, such as descriptions, is ignored.
+	}
+	return fps, nil
+}
+
+// parseHunkHeader parses the line numbers and counts from a hunk header, such
+// as "@@ -1,3 +1,4 @@".
+func parseHunkHeader(line string) (*hunk, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[3] != "@@" ||
+		!strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return nil, fmt.Errorf("invalid hunk header %q", line)
+	}
+	h := &hunk{header: line}
+	var err error
+	if h.oldStart, h.oldCount, err = parseRange(fields[1][1:]); err != nil {
+		return nil, fmt.Errorf("invalid hunk header %q", line)
+	}
+	if h.newStart, h.newCount, err = parseRange(fields[2][1:]); err != nil {
+		return nil, fmt.Errorf("invalid hunk header %q", line)
+	}
+	return h, nil
+}
+
+// parseRange parses a range of a hunk header, the count defaults to one.
+func parseRange(s string) (start, count int, err error) {
+	count = 1
+	if i := strings.Index(s, ","); i != -1 {
+		if count, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	start, err = strconv.Atoi(s)
+	return start, count, err
+}
+
+// apply applies the hunks to the contents of the file, returns the patched
+// contents or the errors of the hunks that could not be applied.
+func (fp *filePatch) apply(src []byte) ([]byte, errHunks) {
+	cur := splitLines(src)
+	out := make([]string, 0, len(cur))
+	errs := make(errHunks, 0)
+	pos, offset := 0, 0 // lines of cur consumed, drift from the headers
+	for _, h := range fp.hunks {
+		old, new := make([]string, 0), make([]string, 0)
+		for _, l := range h.lines {
+			if l.op != diffInsert {
+				old = append(old, l.text)
+			}
+			if l.op != diffDelete {
+				new = append(new, l.text)
+			}
+		}
+		// The start is the line preceding the hunk when there are no
+		// old lines.
+		want := h.oldStart - 1 + offset
+		if h.oldCount == 0 {
+			want++
+		}
+		// The new lines in place means the hunk was applied already, its
+		// old lines could still match when one is a prefix of the other,
+		// then the longer match wins.
+		if linesAt(cur, new, want) && !sameLines(old, new) &&
+			(!linesAt(cur, old, want) || len(new) > len(old)) {
+			errs = append(errs, &errHunk{fp.name(), h, true})
+			continue
+		}
+		at := findLines(cur, old, want, pos)
+		if at == -1 {
+			errs = append(errs, &errHunk{fp.name(), h, false})
+			continue
+		}
+		out = append(append(out, cur[pos:at]...), new...)
+		pos = at + len(old)
+		offset = at - (h.oldStart - 1)
+		if h.oldCount == 0 {
+			offset--
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	out = append(out, cur[pos:]...)
+	return []byte(strings.Join(out, "")), nil
+}
+
+// findLines finds the position of the lines in the contents nearest to the
+// wanted position, not before the minimum position. Returns -1 if the lines are
+// not found.
+func findLines(cur, lines []string, want, min int) int {
+	match := func(at int) bool {
+		return at >= min && linesAt(cur, lines, at)
+	}
+	for d := 0; d <= len(cur); d++ {
+		if match(want - d) {
+			return want - d
+		} else if match(want + d) {
+			return want + d
+		}
+	}
+	return -1
+}
+
+// linesAt checks whether the lines are found in the contents at the position.
+func linesAt(cur, lines []string, at int) bool {
+	if at < 0 || at+len(lines) > len(cur) {
+		return false
+	}
+	return sameLines(cur[at:at+len(lines)], lines)
+}
+
+// sameLines checks whether both lists hold the same lines.
+func sameLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// errHunk is returned when a hunk cannot be applied to a file.
+type errHunk struct {
+	file string
+	h    *hunk
+	// applied is whether the hunk was already applied.
+	applied bool
+}
+
+func (e *errHunk) Error() string {
+	if e.applied {
+		return fmt.Sprintf("%s : hunk %s already applied", e.file, e.h.header)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s : hunk %s failed, expected :\n", e.file, e.h.header)
+	for _, l := range e.h.lines {
+		switch l.op {
+		case diffEqual:
+			buf.WriteByte(' ')
+		case diffDelete:
+			buf.WriteByte('-')
+		default:
+			continue
+		}
+		buf.WriteString(strings.TrimSuffix(l.text, "\n") + "\n")
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// errHunks is returned when hunks of a patch cannot be applied.
+type errHunks []*errHunk
+
+func (e errHunks) Error() string {
+	errs := make([]string, 0, len(e))
+	for _, h := range e {
+		errs = append(errs, h.Error())
+	}
+	return fmt.Sprintf("%d hunks failed :\n%s", len(e), strings.Join(errs, "\n"))
+}
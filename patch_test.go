@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestApplyPatch tests that the diffs output by unifiedDiff apply back, also at
+// an offset, and that failing hunks are reported with their context.
+func TestApplyPatch(t *testing.T) {
+	for _, tt := range unifiedDiffTests {
+		if len(tt.out) == 0 {
+			continue
+		}
+		for _, prefix := range []string{"", "x\ny\n"} {
+			if len(tt.a) == 0 && len(prefix) > 0 {
+				continue // no context to locate the hunk
+			}
+			fps, err := parsePatch([]byte(tt.out))
+			if err != nil {
+				t.Fatalf("parsing %q : %s", tt.out, err.Error())
+			}
+			if len(fps) != 1 || fps[0].name() != "f" {
+				t.Fatalf("parsing %q : got %d files", tt.out, len(fps))
+			}
+			out, errs := fps[0].apply([]byte(prefix + tt.a))
+			if len(errs) > 0 {
+				t.Errorf("applying %q to %q : %s", tt.out, prefix+tt.a, errs.Error())
+			} else if string(out) != prefix+tt.b {
+				t.Errorf("applying %q to %q : got %q, expected %q",
+					tt.out, prefix+tt.a, out, prefix+tt.b)
+			}
+		}
+	}
+	// Failing hunk.
+	fps, err := parsePatch([]byte("--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs := fps[0].apply([]byte("a\nz\nc\n"))
+	expected := "f : hunk @@ -1,3 +1,3 @@ failed, expected :\n a\n-b\n c"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("got errors %v, expected %s", errs, expected)
+	}
+	// Invalid patches.
+	for _, src := range []string{
+		"--- a/f\n@@ -1 +1 @@\n",
+		"--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n",
+		"--- a/f\n+++ b/f\n@@ -1 +1 @@\n*a\n",
+	} {
+		if _, err := parsePatch([]byte(src)); err == nil {
+			t.Errorf("parsing %q : expected error", src)
+		}
+	}
+}
+
+// TestPatch tests the patch subcommand, saving local modifications to a copied
+// package and applying them after the package is copied again.
+func TestPatch(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func() { opt.force = false }()
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	if err := cp(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, false); err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	file := filepath.Join(dstDir, "y.go")
+	src, err := getFileContents(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := append(src, []byte("\n// Patched locally.\n")...)
+	if err := ioutil.WriteFile(file, modified, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := patchSave(ctx, pkgDir, pkgDir, dstDir); err != nil {
+		t.Fatalf("error during patch save : %s", err.Error())
+	}
+	patch, err := getFileContents(filepath.Join(pkgDir, "patches", "lib", "y.patch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(patch), "+// Patched locally.\n") {
+		t.Errorf("unexpected patch :\n%s", patch)
+	}
+	// Saved from a subdirectory, the patch file is named from the root.
+	libDir := filepath.Join(pkgDir, "lib")
+	if err := patchSave(ctx, pkgDir, libDir, "y"); err != nil {
+		t.Fatalf("error during patch save : %s", err.Error())
+	}
+	testExists(t, filepath.Join(libDir, "patches"), false)
+	if again, err := getFileContents(filepath.Join(pkgDir, "patches", "lib", "y.patch")); err != nil {
+		t.Fatal(err)
+	} else if string(again) != string(patch) {
+		t.Errorf("unexpected patch :\n%s", again)
+	}
+	// Copy again, losing the modification, then apply.
+	opt.force = true
+	if err := cp(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, false); err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	if err := patchApply(pkgDir, pkgDir, dstDir); err != nil {
+		t.Fatalf("error during patch apply : %s", err.Error())
+	}
+	if out, err := getFileContents(file); err != nil {
+		t.Fatal(err)
+	} else if string(out) != string(modified) {
+		t.Errorf("got\n%s\nexpected\n%s", out, modified)
+	}
+	// The patched files are accepted.
+	r, err := readRecord(dstDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := hashDir(dstDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, rm, m := compareDigests(r.Files, files); len(a)+len(rm)+len(m) > 0 {
+		t.Errorf("record not updated : %v %v %v", a, rm, m)
+	}
+	// Applying again fails, leaving the files alone.
+	if err := patchApply(pkgDir, pkgDir, dstDir); err == nil {
+		t.Error("expected failing hunks")
+	} else if !strings.Contains(err.Error(), "already applied") {
+		t.Errorf("unexpected error %s", err.Error())
+	}
+	if out, err := getFileContents(file); err != nil {
+		t.Fatal(err)
+	} else if string(out) != string(modified) {
+		t.Errorf("files changed by failing patch, got\n%s", out)
+	}
+}
+
+// TestPatchGet tests saving the modifications made to a copy made by get,
+// whose upstream package is not in the GOPATH.
+func TestPatchGet(t *testing.T) {
+	repo := testGitRepo(t, map[string]string{
+		"r.go": "package r // import \"other.com/r\"\n",
+	})
+	defer os.RemoveAll(repo)
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "get"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	if err := get(context.Background(), ctx, pkgDir, repo, "v1", "lib/r", false, false); err != nil {
+		t.Fatalf("get error : %s", err.Error())
+	}
+	file := filepath.Join(pkgDir, "lib", "r", "r.go")
+	if err := ioutil.WriteFile(file, []byte("package r\n\n// Patched locally.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := patchSave(ctx, pkgDir, pkgDir, filepath.Join("lib", "r")); err != nil {
+		t.Fatalf("error during patch save : %s", err.Error())
+	}
+	patch, err := getFileContents(filepath.Join(pkgDir, "patches", "lib", "r.patch"))
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(patch), "+// Patched locally.\n") {
+		t.Errorf("unexpected patch :\n%s", patch)
+	}
+}
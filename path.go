@@ -1,16 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"go/ast"
 	"go/build"
 	"go/parser"
-	"go/printer"
 	"go/token"
-
-	"os"
-
-	"github.com/emil2k/vend/lib/astutil"
+	pathpkg "path"
+	"sort"
+	"strconv"
 )
 
 // path subcommand updates the import paths in the `cwd` directory that
@@ -18,7 +17,16 @@ import (
 // equivalent import in the `to` path.
 // Recurses into subdirectories to update import paths based on the `recurse`
 // parameter.
-func path(ctx *build.Context, cwd, from, to string, recurse bool) error {
+// Once the `cctx` context is done finishes updating the current package and
+// returns an errInterrupted, listing the packages that were updated and those
+// that still need to be.
+func path(cctx context.Context, ctx *build.Context, cwd, from, to string, recurse bool) error {
+	r := newRewriter(ctx, cwd, to)
+	done := make([]string, 0)
+	// rwPaths compiles the map of import paths to change in the package.
+	rwPaths := func(cwdPkg *build.Package) (map[string]string, error) {
+		return rwImportPaths(getImports(cwdPkg, true), from, to)
+	}
 	process := func(cwdPkg *build.Package, _ error) error {
 		// Get a list of all imports for the package in the cwd
 		// directory, to determine which child package also need to be
@@ -28,41 +36,146 @@ func path(ctx *build.Context, cwd, from, to string, recurse bool) error {
 			return fmt.Errorf("no import path or directory for cwd package")
 		}
 		// Compile map of import paths to change.
-		rw := make(map[string]string)
-		// Get the children of the cwd package their import paths will
-		// be updated as well.
-		for _, a := range getImports(cwdPkg, true) {
-			switch {
-			case from == a:
-				rw[from] = to
-			case isChildPackage(from, a):
-				cp, err := changeImportPath(from, to, a)
-				if err != nil {
-					return err
-				}
-				rw[a] = cp
-			}
+		rw, err := rwPaths(cwdPkg)
+		if err != nil {
+			return err
 		}
 		if len(rw) > 0 {
-			return rwDir(cwdDir, rw)
+			if err := r.withPaths(rw).rwDir(cwdDir); err != nil {
+				return err
+			}
+			done = append(done, "updated the imports in "+cwdDir)
 		}
 		return nil
 	}
+	var err error
 	if recurse {
 		// Recurse into subdirectory packages.
-		if err := recursePackages(ctx, cwd, process); err != nil {
-			return err
+		err = recursePackages(cctx, ctx, cwd, process)
+	} else if cctx.Err() != nil {
+		err = &errInterrupted{pending: []string{cwd}}
+	} else {
+		err = process(getPackage(ctx, cwd, cwd))
+	}
+	if ie, ok := err.(*errInterrupted); ok {
+		// Only list the pending packages that need updating.
+		pending := make([]string, 0)
+		for _, dir := range ie.pending {
+			pkg, _ := getPackage(ctx, dir, dir)
+			if rw, _ := rwPaths(pkg); len(rw) > 0 {
+				pending = append(pending, "update the imports in "+dir)
+			}
 		}
-	} else if err := process(getPackage(ctx, cwd, cwd)); err != nil {
-		return err
+		return &errInterrupted{done: done, pending: pending}
 	}
-	return nil
+	return err
 }
 
-// rwDir goes through the package in the srcDir and updates import path as
+// rewriter rewrites import paths inside of files.
+type rewriter struct {
+	// rw maps the import paths to change to their new import paths.
+	rw map[string]string
+	// group regroups the imports of rewritten files when not nil, see
+	// regroupImports.
+	group func(imp string) int
+	// name resolves the package name of an import path, returns an empty
+	// string if it cannot be resolved.
+	name func(imp string) string
+	// selectors is whether to rename the qualified identifiers of a
+	// rewritten import whose package name changes, instead of adding an
+	// import name that preserves them.
+	selectors bool
+}
+
+// newRewriter makes a rewriter that resolves package names from the `cwd`
+// directory, without any import paths to change.
+// With the opt.group option set regroups the imports of rewritten files, the
+// package in the `cwd` directory and the `to` import path are local.
+// With the opt.selectors option set renames qualified identifiers when the
+// package name of a rewritten import changes.
+func newRewriter(ctx *build.Context, cwd, to string) *rewriter {
+	r := &rewriter{
+		name: func(imp string) string {
+			pkg, _ := getPackage(ctx, cwd, imp)
+			return pkg.Name
+		},
+		selectors: opt.selectors,
+	}
+	if opt.group {
+		local := []string{to}
+		if imp, err := getImportPath(ctx, cwd, cwd); err == nil {
+			local = append(local, imp)
+		}
+		r.group = importGroup(ctx, cwd, local)
+	}
+	return r
+}
+
+// withPaths returns a copy of the rewriter that changes the import paths as
 // specified by the rw map, from key to value.
+func (r *rewriter) withPaths(rw map[string]string) *rewriter {
+	c := *r
+	c.rw = rw
+	return &c
+}
+
+// pkgName returns the package name of the import path, guesses it from the last
+// element of the import path if it cannot be resolved.
+func (r *rewriter) pkgName(imp string) string {
+	if r.name != nil {
+		if name := r.name(imp); len(name) > 0 {
+			return name
+		}
+	}
+	return pathpkg.Base(imp)
+}
+
+// nameChange checks whether the package name changes when an unnamed import is
+// rewritten from the old path, op, to the new path, np. Returns the old and the
+// new package names, if both can be resolved and differ.
+func (r *rewriter) nameChange(op, np string) (on, nn string, changed bool) {
+	if op == np || r.name == nil {
+		return "", "", false
+	}
+	on, nn = r.name(op), r.name(np)
+	return on, nn, len(on) > 0 && len(nn) > 0 && on != nn
+}
+
+// finalName returns the package name an import spec is referred by in the file
+// once it is rewritten to the new path, np.
+func (r *rewriter) finalName(is *ast.ImportSpec, np string) string {
+	if is.Name != nil {
+		return is.Name.Name
+	}
+	if on, _, changed := r.nameChange(specPath(is), np); changed && !r.selectors {
+		return on // preserved by an added import name
+	}
+	return r.pkgName(np)
+}
+
+// rwImportPaths compiles a map of the import paths to change from the passed
+// imports, the `from` import path and the import paths of its child packages
+// map to their equivalent in the `to` import path.
+func rwImportPaths(imports []string, from, to string) (map[string]string, error) {
+	rw := make(map[string]string)
+	for _, a := range imports {
+		switch {
+		case from == a:
+			rw[from] = to
+		case isChildPackage(from, a):
+			cp, err := changeImportPath(from, to, a)
+			if err != nil {
+				return nil, err
+			}
+			rw[a] = cp
+		}
+	}
+	return rw, nil
+}
+
+// rwDir goes through the package in the srcDir and updates import paths.
 // Returns an error if unable to parse the package or if writing to a file.
-func rwDir(srcDir string, rw map[string]string) error {
+func (r *rewriter) rwDir(srcDir string) error {
 	fs := token.NewFileSet()
 	mode := parser.AllErrors | parser.ParseComments
 	pkgs, err := parser.ParseDir(fs, srcDir, nil, mode)
@@ -71,7 +184,7 @@ func rwDir(srcDir string, rw map[string]string) error {
 	}
 	for _, pkg := range pkgs {
 		for _, f := range pkg.Files {
-			if err := rwFile(fs, f, rw); err != nil {
+			if err := r.rwFile(fs, f); err != nil {
 				return err
 			}
 		}
@@ -79,56 +192,180 @@ func rwDir(srcDir string, rw map[string]string) error {
 	return nil
 }
 
-// rwFile rewrites the import paths inside a file based on the rw map from keys
-// to values.
-// Returns an error if writing or closing the file fails.
-func rwFile(fs *token.FileSet, f *ast.File, rw map[string]string) error {
-	for op, np := range rw {
-		if err := rwImport(fs, f, op, np); err != nil {
+// rwFile rewrites the import paths inside a file, and then writes the changes
+// to it.
+// Only the string literals of the changed imports are replaced, the rest of the
+// file is left byte identical, unless imports are merged or regrouped.
+// Returns an error if reading or writing the file fails, or if imports cannot
+// be merged.
+func (r *rewriter) rwFile(fs *token.FileSet, f *ast.File) error {
+	tf := fs.File(f.Pos())
+	if tf == nil {
+		return nil
+	}
+	src, err := getFileContents(tf.Name())
+	if err != nil {
+		return err
+	}
+	out, rewrote, err := r.rwImports(fs, f, src)
+	if err != nil || len(rewrote) == 0 {
+		return err
+	}
+	if r.group != nil {
+		if out, err = regroupSrc(tf.Name(), out, r.group); err != nil {
 			return err
 		}
 	}
+	if err := backupFile(tf.Name()); err != nil {
+		return err
+	} else if err := writeFile(tf.Name(), out, 0644); err != nil {
+		return err
+	}
+	// Output
+	if opt.verbose {
+		for _, op := range rewrote {
+			printBold(fmt.Sprintf("%s => %s", op, r.rw[op]))
+			fmt.Println(tf.Name())
+		}
+	}
 	return nil
 }
 
-// printerConfig configures the AST pretty printing, it should use space for
-// alignment and tabs to indent to mirror gofmt.
-var printerConfig = &printer.Config{
-	Mode:     printer.UseSpaces | printer.TabIndent,
-	Tabwidth: 8,
-	Indent:   0,
+// rwSrc rewrites the import paths inside the source of a file, and returns the
+// resulting source without writing it. The name is used to report errors.
+// If none of the import paths are used in the source it is returned unchanged.
+// Returns an error if unable to parse the source, or if imports cannot be
+// merged.
+func (r *rewriter) rwSrc(name string, src []byte) ([]byte, error) {
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, name, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	out, rewrote, err := r.rwImports(fs, f, src)
+	if err != nil || len(rewrote) == 0 || r.group == nil {
+		return out, err
+	}
+	return regroupSrc(name, out, r.group)
 }
 
-// rwImport rewrites the import path from the old path, op, to the new path, np,
-// inside a file and then writes the changes to it.
-// If the old path is not used in a file nothing and an nil error is returned.
-// Returns an error if writing or closing the file fails.
-func rwImport(fs *token.FileSet, f *ast.File, op, np string) (err error) {
-	if rw := astutil.RewriteImport(fs, f, op, np); !rw {
-		return nil
+// regroupSrc parses the source and regroups its imports with the group
+// function, see regroupImports. The name is used to report errors.
+func regroupSrc(name string, src []byte, group func(string) int) ([]byte, error) {
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, name, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	out, _ := regroupImports(fs, f, src, group)
+	return out, nil
+}
+
+// rwImports rewrites the import paths of the parsed file, with the source src.
+// Only the string literals of the changed import specs are replaced, found
+// through their token positions, so the rest of the source is left byte
+// identical.
+// When a rewrite duplicates another import in the file the imports are merged,
+// see mergeImports.
+// When the package name of an unnamed import changes, the old package name is
+// added as the import name to preserve the qualified identifiers used in the
+// file, or the qualified identifiers are renamed if the selectors option is
+// set.
+// Returns the resulting source and a sorted list of the import paths that were
+// rewritten.
+func (r *rewriter) rwImports(fs *token.FileSet, f *ast.File, src []byte) ([]byte, []string, error) {
+	rewrote := make([]string, 0)
+	specs := make(map[string][]*ast.ImportSpec) // new import path to specs
+	for _, is := range f.Imports {
+		op := specPath(is)
+		np, ok := r.rw[op]
+		if !ok || np == op {
+			np = op
+		} else {
+			rewrote = appendUnique(rewrote, op)
+		}
+		specs[np] = append(specs[np], is)
+	}
+	if len(rewrote) == 0 {
+		return src, rewrote, nil
 	}
-	// Open up the file and write the changes to it.
-	if tf := fs.File(f.Pos()); tf != nil {
-		var wf *os.File
-		wf, err = os.OpenFile(tf.Name(), os.O_WRONLY|os.O_TRUNC, 0600)
+	edits := make([]edit, 0)
+	removed := make(map[*ast.ImportSpec]bool)
+	for np, dupes := range specs {
+		if len(dupes) < 2 {
+			continue
+		}
+		me, rm, err := r.mergeImports(fs, f, src, np, dupes)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		// Properly catch a close error
-		defer func() {
-			if cerr := wf.Close(); err == nil {
-				err = cerr
-			}
-		}()
-		// Print properly
-		if err = printerConfig.Fprint(wf, fs, f); err != nil {
-			return err
+		edits = append(edits, me...)
+		for _, is := range rm {
+			removed[is] = true
 		}
-		// Output
-		if opt.verbose {
-			printBold(fmt.Sprintf("%s => %s", op, np))
-			fmt.Println(tf.Name())
+	}
+	for np, specs := range specs {
+		for _, is := range specs {
+			op := specPath(is)
+			if np == op || removed[is] {
+				continue
+			}
+			text := strconv.Quote(np)
+			if on, nn, changed := r.nameChange(op, np); is.Name == nil && changed {
+				if !r.selectors {
+					text = on + " " + text
+				} else if pos := findDecl(f, nn); pos.IsValid() {
+					return nil, nil, fmt.Errorf("%s: cannot rename qualified identifiers of %q from %s to %s, %s is declared at %s",
+						fs.Position(is.Pos()), np, on, nn, nn, fs.Position(pos))
+				} else {
+					edits = append(edits, renameSelectors(fs, f, on, nn)...)
+				}
+			}
+			edits = append(edits, edit{
+				fs.Position(is.Path.Pos()).Offset,
+				fs.Position(is.Path.End()).Offset,
+				text,
+			})
 		}
 	}
-	return nil
+	sort.Strings(rewrote)
+	return applyEdits(src, edits), rewrote, nil
+}
+
+// edit replaces the bytes of a source located between the start and end
+// offsets with the text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// byStart sorts edits by their start offset.
+type byStart []edit
+
+func (e byStart) Len() int           { return len(e) }
+func (e byStart) Less(i, j int) bool { return e[i].start < e[j].start }
+func (e byStart) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// applyEdits applies the edits, which must not overlap, to the src and returns
+// the result in a new slice.
+func applyEdits(src []byte, edits []edit) []byte {
+	sort.Stable(byStart(edits))
+	out := make([]byte, 0, len(src))
+	var last int
+	for _, e := range edits {
+		out = append(out, src[last:e.start]...)
+		out = append(out, e.text...)
+		last = e.end
+	}
+	return append(out, src[last:]...)
+}
+
+// specPath returns the unquoted import path of the import spec, or an empty
+// string if it cannot be unquoted.
+func specPath(is *ast.ImportSpec) string {
+	imp, err := strconv.Unquote(is.Path.Value)
+	if err != nil {
+		return ""
+	}
+	return imp
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -14,7 +16,7 @@ func TestUpdate(t *testing.T) {
 	ctx := getTestContextCopy(t, filepath.Join("testdata", "update"))
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
-	err := path(ctx, pkgDir, "go", "mygo", false)
+	err := path(context.Background(), ctx, pkgDir, "go", "mygo", false)
 	if err != nil {
 		t.Errorf("update error : %s", err.Error())
 	}
@@ -33,7 +35,7 @@ func TestPathRecurse(t *testing.T) {
 	ctx := getTestContextCopy(t, filepath.Join("testdata", "update"))
 	defer os.RemoveAll(ctx.GOPATH)
 	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
-	err := path(ctx, pkgDir, "go", "mygo", true)
+	err := path(context.Background(), ctx, pkgDir, "go", "mygo", true)
 	if err != nil {
 		t.Errorf("update error : %s", err.Error())
 	}
@@ -45,3 +47,69 @@ func TestPathRecurse(t *testing.T) {
 	testImports(t, childPkgDir,
 		[]string{"fmt", "os", "mygo/ast", "mygo/parser"}, false)
 }
+
+// TestPathPreservesFormatting tests that the path subcommand only replaces the
+// string literals of the changed imports, leaving the rest of the file byte
+// identical including a byte order mark, CRLF line endings, and formatting that
+// was never gofmt'd.
+func TestPathPreservesFormatting(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "update"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	src := "\xef\xbb\xbfpackage x\r\n\r\n" +
+		"import (\r\n" +
+		"  _   \"go/ast\"    // aligned\r\n" +
+		"\t_ `go/parser`   /* by hand */\r\n" +
+		")\r\n\r\n" +
+		"var  A=1\r\n"
+	expected := "\xef\xbb\xbfpackage x\r\n\r\n" +
+		"import (\r\n" +
+		"  _   \"mygo/ast\"    // aligned\r\n" +
+		"\t_ \"mygo/parser\"   /* by hand */\r\n" +
+		")\r\n\r\n" +
+		"var  A=1\r\n"
+	filePath := filepath.Join(pkgDir, "format.go")
+	if err := ioutil.WriteFile(filePath, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := path(context.Background(), ctx, pkgDir, "go", "mygo", false); err != nil {
+		t.Fatalf("update error : %s", err.Error())
+	}
+	out, err := getFileContents(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("file not preserved : got %q, expected %q", out, expected)
+	}
+}
+
+// TestPathGroup tests the path subcommand with the group option, checking that
+// the imports of a rewritten file are sorted and regrouped with the rewritten
+// imports placed in the local group.
+func TestPathGroup(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "update"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func() { opt.group = false }()
+	opt.group = true
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	if err := path(context.Background(), ctx, pkgDir, "go", "example.com/x/lib/go", false); err != nil {
+		t.Fatalf("update error : %s", err.Error())
+	}
+	out, err := getFileContents(filepath.Join(pkgDir, "x.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "// Package x is used to test updating of import paths.\n" +
+		"package x\n\n" +
+		"import (\n" +
+		"\t_ \"fmt\"\n" +
+		"\t_ \"os\"\n\n" +
+		"\t_ \"example.com/x/lib/go/ast\"\n" +
+		"\t_ \"example.com/x/lib/go/build\"\n" +
+		"\t_ \"example.com/x/lib/go/parser\"\n" +
+		")\n"
+	if string(out) != expected {
+		t.Errorf("imports not regrouped : got\n%s\nexpected\n%s", out, expected)
+	}
+}
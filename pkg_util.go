@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"go/build"
@@ -60,7 +61,10 @@ type packageResult struct {
 // change the packages themselves.
 // Returns an error if the passed function returns an error for any of the found
 // packages and in case of permissions issues during recursion.
-func recursePackages(ctx *build.Context, dir string, f func(p *build.Package, err error) error) error {
+// Stops before calling the function on the next package once the `cctx`
+// context is done, returning an errInterrupted that lists the directories of
+// the packages that were not processed.
+func recursePackages(cctx context.Context, ctx *build.Context, dir string, f func(p *build.Package, err error) error) error {
 	pkgs := make([]packageResult, 0)
 	walk := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -85,7 +89,14 @@ func recursePackages(ctx *build.Context, dir string, f func(p *build.Package, er
 		return err
 	}
 	// Call function on packages
-	for _, p := range pkgs {
+	for i, p := range pkgs {
+		if cctx.Err() != nil {
+			pending := make([]string, 0, len(pkgs)-i)
+			for _, p := range pkgs[i:] {
+				pending = append(pending, p.pkg.Dir)
+			}
+			return &errInterrupted{pending: pending}
+		}
 		if err := f(p.pkg, p.err); err != nil {
 			return err
 		}
@@ -126,6 +137,13 @@ func isChildPackage(parent, child string) bool {
 	return strings.HasPrefix(child, parent)
 }
 
+// isImportIn checks if the import path is the parent import path or is one of
+// its child packages, unlike isChildPackage requires the child packages to be
+// located in subdirectories.
+func isImportIn(parent, imp string) bool {
+	return imp == parent || strings.HasPrefix(imp, parent+"/")
+}
+
 // isStandardPackage checks if the package is located in the standard library.
 // If an error is thrown during import assumes it is not in the standard library.
 func isStandardPackage(ctx *build.Context, cwd, path string) bool {
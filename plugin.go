@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// pluginPrefix prefixes the names of plugin executables, the plugin for the foo
+// subcommand is named vend-foo.
+const pluginPrefix = "vend-"
+
+// runPlugin runs the plugin executable for the subcommand found on the PATH,
+// with the arguments, connected to the standard input and output.
+// The plugin gets the import path of the package in the current working
+// directory, the directory, and the GOPATH in the VEND_IMPORT_PATH,
+// VEND_PKG_DIR, and VEND_GOPATH environment variables, the import path is empty
+// if it cannot be resolved. VEND_DIR is left alone as it sets the directory of
+// copied packages, see loadConfig.
+// Returns whether a plugin was found, and an *exec.ExitError if it failed.
+func runPlugin(ctx *build.Context, cwd, name string, args []string) (found bool, err error) {
+	if len(name) == 0 || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\`) {
+		return false, nil
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return false, nil
+	}
+	imp, _ := getImportPath(ctx, cwd, cwd)
+	cmd := exec.Command(path, args...)
+	cmd.Dir = cwd
+	cmd.Env = append(os.Environ(),
+		"VEND_IMPORT_PATH="+imp,
+		"VEND_PKG_DIR="+cwd,
+		"VEND_GOPATH="+ctx.GOPATH,
+	)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return true, cmd.Run()
+}
+
+// findPlugins returns the sorted names of the subcommands provided by plugin
+// executables found on the PATH, skipping built in subcommands.
+func findPlugins() []string {
+	names := make([]string, 0)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		windows := runtime.GOOS == "windows"
+		for _, info := range infos {
+			// Windows has no executable bit, executables are found by
+			// extension instead, see pluginName.
+			if info.IsDir() || (!windows && info.Mode().Perm()&0111 == 0) {
+				continue
+			}
+			name := pluginName(info.Name(), windows)
+			if _, ok := flagMap[name]; !ok && len(name) > 0 {
+				names = appendUnique(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pluginName returns the subcommand provided by the plugin executable with the
+// file name, or an empty string if it is not a plugin. On Windows the extension
+// is stripped if it is one of the executable extensions listed in PATHEXT,
+// otherwise the file is not an executable. Elsewhere file names with an
+// extension are skipped, as the subcommand would include it.
+func pluginName(file string, windows bool) string {
+	if !strings.HasPrefix(file, pluginPrefix) {
+		return ""
+	}
+	ext := filepath.Ext(file)
+	if windows {
+		pathext := os.Getenv("PATHEXT")
+		if len(pathext) == 0 {
+			pathext = ".COM;.EXE;.BAT;.CMD"
+		}
+		found := false
+		for _, e := range strings.Split(pathext, ";") {
+			if len(e) > 0 && strings.EqualFold(e, ext) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ""
+		}
+	} else if len(ext) > 0 {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimSuffix(file, ext), pluginPrefix)
+}
+
+// mainUsageFunc prints the usage of the overall tool, along with the plugins
+// found on the PATH.
+func mainUsageFunc() {
+	fmt.Print(mainUsage + "\n")
+	if plugins := findPlugins(); len(plugins) > 0 {
+		fmt.Print("Plugins found on the PATH :\n\n")
+		for _, p := range plugins {
+			fmt.Printf("  vend %s\n", p)
+		}
+		fmt.Print("\n")
+	}
+	flagMap["main"].PrintDefaults()
+}
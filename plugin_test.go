@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testPluginDir creates a directory on the PATH holding a vend-hello plugin
+// that writes its arguments and environment into out.txt in the current
+// working directory, and exits with the status in its first argument.
+// Returns the directory and a function that restores the PATH.
+func testPluginDir(t *testing.T) (string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin scripts require a POSIX shell")
+	}
+	dir, err := ioutil.TempDir("", "vend-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > out.txt\n" +
+		"echo \"$VEND_IMPORT_PATH\" >> out.txt\n" +
+		"echo \"$VEND_PKG_DIR\" >> out.txt\n" +
+		"echo \"$VEND_GOPATH\" >> out.txt\n" +
+		"echo \"$VEND_DIR\" >> out.txt\n" +
+		"exit $1\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "vend-hello"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Not executable, and shadowing a built in subcommand.
+	if err := ioutil.WriteFile(filepath.Join(dir, "vend-bye"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "vend-cp"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return dir, func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+// TestRunPlugin tests running a plugin for an unknown subcommand, passing the
+// arguments and the environment describing the package in the current working
+// directory.
+func TestRunPlugin(t *testing.T) {
+	_, restore := testPluginDir(t)
+	defer restore()
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	// VEND_DIR sets the directory of copied packages, it is not set for
+	// the plugin.
+	if v, ok := os.LookupEnv("VEND_DIR"); ok {
+		os.Unsetenv("VEND_DIR")
+		defer os.Setenv("VEND_DIR", v)
+	}
+	found, err := runPlugin(ctx, pkgDir, "hello", []string{"0", "a"})
+	if !found || err != nil {
+		t.Fatalf("got found %t and error %v", found, err)
+	}
+	out, err := getFileContents(filepath.Join(pkgDir, "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "0 a\nexample.com/x\n" + pkgDir + "\n" + ctx.GOPATH + "\n\n"
+	if string(out) != expected {
+		t.Errorf("got\n%s\nexpected\n%s", out, expected)
+	}
+	// Failing plugin.
+	found, err = runPlugin(ctx, pkgDir, "hello", []string{"3"})
+	if ee, ok := err.(*exec.ExitError); !found || !ok || ee.ExitCode() != 3 {
+		t.Errorf("got found %t and error %v, expected exit status 3", found, err)
+	}
+	// Missing plugins.
+	for _, name := range []string{"missing", "bye", "-h", "../hello"} {
+		if found, _ := runPlugin(ctx, pkgDir, name, nil); found {
+			t.Errorf("plugin %s should not be found", name)
+		}
+	}
+}
+
+// TestFindPlugins tests listing the executable plugins on the PATH, skipping
+// built in subcommands.
+func TestFindPlugins(t *testing.T) {
+	_, restore := testPluginDir(t)
+	defer restore()
+	got := findPlugins()
+	if !hasString(got, "hello") {
+		t.Errorf("got %v, expected hello", got)
+	}
+	for _, p := range got {
+		if p == "bye" || p == "cp" || strings.HasPrefix(p, pluginPrefix) {
+			t.Errorf("unexpected plugin %s", p)
+		}
+	}
+}
+
+// TestPluginName tests getting the subcommand from the file name of a plugin
+// executable, stripping only the executable extensions on Windows.
+func TestPluginName(t *testing.T) {
+	if v, ok := os.LookupEnv("PATHEXT"); ok {
+		defer os.Setenv("PATHEXT", v)
+	} else {
+		defer os.Unsetenv("PATHEXT")
+	}
+	os.Setenv("PATHEXT", ".COM;.EXE;.BAT;.CMD")
+	cases := []struct {
+		file     string
+		windows  bool
+		expected string
+	}{
+		{"vend-foo", false, "foo"},
+		{"vend-foo.sh", false, ""},
+		{"vend-foo.exe", false, ""},
+		{"foo", false, ""},
+		{"vend-foo.exe", true, "foo"},
+		{"vend-foo.Bat", true, "foo"},
+		{"vend-foo.txt", true, ""},
+		{"vend-foo", true, ""},
+		{"foo.exe", true, ""},
+	}
+	for _, c := range cases {
+		if got := pluginName(c.file, c.windows); got != c.expected {
+			t.Errorf("%s, windows %t : got %q, expected %q", c.file, c.windows, got, c.expected)
+		}
+	}
+	// Default extensions.
+	os.Unsetenv("PATHEXT")
+	if got := pluginName("vend-foo.cmd", true); got != "foo" {
+		t.Errorf("got %q, expected foo with the default PATHEXT", got)
+	}
+}
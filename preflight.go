@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errPreflight is returned when the validation done before a command makes any
+// changes fails, lists every problem found.
+type errPreflight []string
+
+func (e errPreflight) Error() string {
+	return fmt.Sprintf("nothing was changed, problems found :\n%s", strings.Join(e, "\n"))
+}
+
+// checkCopy validates copying the package with the `srcImp` import path from
+// the `src` directory into the `dst` directory, both absolute, see cp, before
+// any changes are made.
+// Checks that the opt.copyMode option is valid, that the destination is
+// located in the GOPATH, that it is not located inside the source nor contains
+// it, that it does not exist unless the opt.force or the opt.sync option is
+// set, and that it can be created. Checks that the Go files of the source
+// parse, skipping directories ignored by the go tool, and that the files that
+// import the package, in the package in the `cwd` directory or the packages
+// located in its subdirectories if `recurse`, parse and are not read-only, see
+// checkRewrite.
+// Returns the problems found.
+func checkCopy(ctx *build.Context, cwd, srcImp, src, dst string, recurse bool) errPreflight {
+	return append(checkCopyFiles(ctx, cwd, src, dst), checkRewrite(ctx, cwd, recurse, srcImp)...)
+}
+
+// checkCopyFiles validates copying the files of the `src` directory into the
+// `dst` directory, the checks of checkCopy other than those of checkRewrite.
+// Returns the problems found.
+func checkCopyFiles(ctx *build.Context, cwd, src, dst string) errPreflight {
+	p := make(errPreflight, 0)
+	if len(opt.copyMode) > 0 && !hasString(copyModes, opt.copyMode) {
+		p = append(p, fmt.Sprintf("invalid copy mode %s, expected one of %s",
+			opt.copyMode, strings.Join(copyModes, ", ")))
+	}
+	if _, err := getImportPath(ctx, cwd, dst); err != nil {
+		p = append(p, fmt.Sprintf("destination %s is not located in the GOPATH", dst))
+	}
+	if isChildDir(src, dst) {
+		p = append(p, fmt.Sprintf("destination %s is located inside the source %s", dst, src))
+	} else if isChildDir(dst, src) {
+		p = append(p, fmt.Sprintf("source %s is located inside the destination %s", src, dst))
+	}
+	if _, err := os.Stat(dst); err == nil && !opt.force && !opt.sync {
+		p = append(p, fmt.Sprintf("destination %s already exists", dst))
+	}
+	// The closest existing directory must allow creating the destination.
+	parent := filepath.Dir(dst)
+	for {
+		if _, err := os.Stat(parent); err == nil || filepath.Dir(parent) == parent {
+			break
+		}
+		parent = filepath.Dir(parent)
+	}
+	if !dirWritable(parent) {
+		p = append(p, fmt.Sprintf("directory %s is not writable", parent))
+	}
+	filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			p = append(p, err.Error())
+			return nil
+		} else if info.IsDir() && path != src && (info.Name() == "testdata" ||
+			strings.HasPrefix(info.Name(), ".") || strings.HasPrefix(info.Name(), "_")) {
+			return filepath.SkipDir // ignored by the go tool
+		} else if !info.IsDir() && filepath.Ext(path) == ".go" {
+			if err := parseCheck(path); err != nil {
+				p = append(p, err.Error())
+			}
+		}
+		return nil
+	})
+	return p
+}
+
+// checkRewrite validates updating the imports of the `from` import paths, and
+// of their child packages, in the package in the `cwd` directory, or in all the
+// packages located in its subdirectories if `recurse`, see path, before any
+// changes are made. The packages are only gone through once for all the import
+// paths.
+// Checks that all the Go files of the packages that import them, which are
+// parsed and rewritten, parse and are not read-only.
+// Returns the problems found.
+func checkRewrite(ctx *build.Context, cwd string, recurse bool, from ...string) errPreflight {
+	p := make(errPreflight, 0)
+	// imports checks whether the package imports any of the import paths.
+	imports := func(pkg *build.Package) bool {
+		for _, f := range from {
+			if rw, err := rwImportPaths(getImports(pkg, true), f, f); err == nil && len(rw) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	process := func(pkg *build.Package, _ error) error {
+		if len(pkg.Dir) == 0 || !imports(pkg) {
+			return nil
+		}
+		files, err := filepath.Glob(filepath.Join(pkg.Dir, "*.go"))
+		if err != nil {
+			p = append(p, err.Error())
+			return nil
+		}
+		for _, f := range files {
+			if !fileWritable(f) {
+				p = append(p, fmt.Sprintf("file %s is read-only", f))
+			} else if err := parseCheck(f); err != nil {
+				p = append(p, err.Error())
+			}
+		}
+		return nil
+	}
+	if recurse {
+		if err := recursePackages(context.Background(), ctx, cwd, process); err != nil {
+			p = append(p, err.Error())
+		}
+	} else {
+		process(getPackage(ctx, cwd, cwd))
+	}
+	return p
+}
+
+// parseCheck checks whether the Go file parses.
+func parseCheck(path string) error {
+	_, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.AllErrors)
+	return err
+}
+
+// fileWritable checks whether the file is not read-only and can be opened for
+// writing, without changing it.
+func fileWritable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm()&0222 == 0 {
+		return false
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// dirWritable checks whether files can be created in the directory, by creating
+// and removing a temporary file.
+func dirWritable(dir string) bool {
+	f, err := ioutil.TempFile(dir, ".vend-preflight")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
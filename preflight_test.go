@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCpPreflight tests that cp reports every problem found before making any
+// changes, even with the opt.force option set.
+func TestCpPreflight(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func(force bool) {
+		opt.force = force
+	}(opt.force)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	srcDir := filepath.Join(ctx.GOPATH, "src", "other.com", "y")
+	// Destination outside of the GOPATH.
+	outDir, err := ioutil.TempDir("", "vend-preflight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+	err = cp(context.Background(), ctx, pkgDir, "other.com/y", filepath.Join(outDir, "y"), false, false)
+	if p, ok := err.(errPreflight); !ok || len(p) != 1 ||
+		!strings.Contains(p[0], "not located in the GOPATH") {
+		t.Errorf("expected a GOPATH problem, got %v", err)
+	}
+	testExists(t, filepath.Join(outDir, "y"), false)
+	// Existing destination, a source file that does not parse, and a
+	// read-only file that imports the source.
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(srcDir, "bad.go"), []byte("package y\nfunc {"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(pkgDir, "x.go"), 0444); err != nil {
+		t.Fatal(err)
+	}
+	err = cp(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, false)
+	p, ok := err.(errPreflight)
+	if !ok || len(p) != 3 {
+		t.Fatalf("expected three problems, got %v", err)
+	}
+	for i, expected := range []string{"already exists", "bad.go", "x.go is read-only"} {
+		if !strings.Contains(p[i], expected) {
+			t.Errorf("problem %d : got %s, expected %s", i, p[i], expected)
+		}
+	}
+	// The forced copy does not remove the destination.
+	opt.force = true
+	if err = cp(context.Background(), ctx, pkgDir, "other.com/y", dstDir, false, false); err == nil {
+		t.Errorf("expected an error")
+	}
+	testExists(t, dstDir, true)
+	testImports(t, pkgDir, []string{"other.com/y"}, false)
+}
+
+// TestCheckRewrite tests that the packages that import any of the import paths
+// are checked, reporting each problem once.
+func TestCheckRewrite(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	if p := checkRewrite(ctx, pkgDir, true, "other.com/none"); len(p) > 0 {
+		t.Errorf("expected no problems, got %v", p)
+	}
+	if err := os.Chmod(filepath.Join(pkgDir, "x.go"), 0444); err != nil {
+		t.Fatal(err)
+	}
+	p := checkRewrite(ctx, pkgDir, true, "other.com/none", "other.com/y", "other.com/y/sub")
+	if len(p) != 1 || !strings.Contains(p[0], "x.go is read-only") {
+		t.Errorf("expected a read-only problem, got %v", p)
+	}
+}
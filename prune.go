@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// prune runs the prune subcommand, finds the packages located in the vendor
+// directory, dir, that are no longer reachable through the imports of any of
+// the packages in the current working directory that are not located in the
+// vendor directory.
+// Vendored packages that import each other are taken into account, a vendored
+// package is only reachable if it is imported by a non-vendored package or by
+// a reachable vendored package.
+// When the vendor directory contains the current working directory, as it does
+// by default, only the packages located in copies, directories holding a
+// record, are considered vendored, see findRecords.
+// Lists the unreachable packages and removes them when the opt.force option is
+// set, updating the records of the copies they were located in.
+func prune(ctx *build.Context, cwd, dir string) error {
+	dir, err := cwdAbs(cwd, dir)
+	if err != nil {
+		return err
+	}
+	isVendored := func(pkgDir string) bool {
+		return isChildDir(dir, pkgDir)
+	}
+	if isChildDir(dir, cwd) {
+		copies, err := findRecords(cwd)
+		if err != nil {
+			return err
+		}
+		isVendored = func(pkgDir string) bool {
+			for _, c := range copies {
+				if isChildDir(c, pkgDir) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	roots := make([]*build.Package, 0)
+	vendored := make(map[string]*build.Package) // import path to package
+	process := func(pkg *build.Package, _ error) error {
+		// Skip directories without a package.
+		if len(pkg.ImportPath) == 0 || len(pkg.Name) == 0 {
+			return nil
+		}
+		if isVendored(pkg.Dir) {
+			vendored[pkg.ImportPath] = pkg
+		} else {
+			roots = append(roots, pkg)
+		}
+		return nil
+	}
+	if err := recursePackages(context.Background(), ctx, cwd, process); err != nil {
+		return err
+	}
+	// Mark the vendored packages that can be reached from the roots, the
+	// test imports of the vendored packages are not considered as they are
+	// not necessary to build the project.
+	reached := make(map[string]bool)
+	queue := make([]string, 0)
+	for _, pkg := range roots {
+		queue = append(queue, getImports(pkg, true)...)
+	}
+	for len(queue) > 0 {
+		imp := queue[0]
+		queue = queue[1:]
+		if pkg, ok := vendored[imp]; ok && !reached[imp] {
+			reached[imp] = true
+			queue = append(queue, getImports(pkg, false)...)
+		}
+	}
+	// Compile the list of unreachable packages.
+	unused := make([]string, 0)
+	for imp := range vendored {
+		if !reached[imp] {
+			unused = append(unused, imp)
+		}
+	}
+	sort.Strings(unused)
+	if len(unused) == 0 {
+		fmt.Println("No unused vendored packages found.")
+		return nil
+	}
+	for _, imp := range unused {
+		pkg := vendored[imp]
+		if opt.verbose {
+			printBold(fmt.Sprintf("%s (%s)", pkg.ImportPath, pkg.Name))
+			fmt.Println(pkg.Dir)
+		} else {
+			fmt.Println(pkg.ImportPath)
+		}
+	}
+	if !opt.force {
+		fmt.Println("\nRun with the -f flag to remove the packages.")
+		return nil
+	}
+	// Find the copies holding the packages, before they are removed, so that
+	// their records can be updated.
+	records, err := findRecords(cwd)
+	if err != nil {
+		return err
+	}
+	// Remove the unreachable packages, keeping any reachable packages that
+	// are located in their subdirectories.
+	changed := make([]string, 0)
+	for _, imp := range unused {
+		pkg := vendored[imp]
+		if err := removePackage(pkg, reached, vendored); err != nil {
+			return err
+		}
+		// The copy holding the package is the closest directory with a
+		// record.
+		var owner string
+		for _, d := range records {
+			if isChildDir(d, pkg.Dir) && len(d) > len(owner) {
+				owner = d
+			}
+		}
+		if len(owner) > 0 {
+			changed = appendUnique(changed, owner)
+		}
+	}
+	return updateRecords(changed)
+}
+
+// updateRecords updates the file digests in the records of the copies in the
+// directories after files were removed from them. Records of copies that were
+// removed entirely are gone with their directories, records of copies left
+// without any files are removed.
+func updateRecords(dirs []string) error {
+	for _, d := range dirs {
+		if !hasRecord(d) {
+			continue
+		}
+		files, err := hashDir(d)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			if err := os.Remove(filepath.Join(d, recordName)); err != nil {
+				return err
+			}
+			continue
+		}
+		rec, err := readRecord(d)
+		if err != nil {
+			return err
+		}
+		rec.Files = files
+		if err := writeRecord(d, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removePackage removes the package's directory, unless it contains packages
+// that are still in use in its subdirectories, in which case only the Go source
+// files of the package itself are removed.
+// The reached map is keyed by the import paths of packages that are in use,
+// the vendored map is keyed by import paths of all the vendored packages.
+func removePackage(pkg *build.Package, reached map[string]bool, vendored map[string]*build.Package) error {
+	for imp := range reached {
+		if vendored[imp].Dir != pkg.Dir && isChildDir(pkg.Dir, vendored[imp].Dir) {
+			return removeGoFiles(pkg.Dir)
+		}
+	}
+	return os.RemoveAll(pkg.Dir)
+}
+
+// removeGoFiles removes the Go source files located in the directory, does not
+// descend into subdirectories.
+func removeGoFiles(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
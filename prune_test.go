@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPrune tests the prune subcommand with the force option, checking that
+// only the vendored packages that are no longer reachable are removed. Tests
+// that vendored packages imported only through other vendored packages or
+// test files are kept, and that used packages located in the subdirectory of
+// an unused package are kept.
+func TestPrune(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "prune"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func() { opt.force = false }()
+	opt.force = true
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	libDir := filepath.Join(pkgDir, "lib")
+	if err := prune(ctx, pkgDir, "lib"); err != nil {
+		t.Fatalf("error during prune : %s", err.Error())
+	}
+	testExists(t, filepath.Join(libDir, "a", "a.go"), true)
+	testExists(t, filepath.Join(libDir, "b", "b.go"), true)
+	testExists(t, filepath.Join(libDir, "c", "c.go"), false)
+	testExists(t, filepath.Join(libDir, "c", "d", "d.go"), true)
+	testExists(t, filepath.Join(libDir, "e"), false)
+	testExists(t, filepath.Join(libDir, "f"), false)
+}
+
+// TestPruneRecords tests that the prune subcommand updates the record of a copy
+// when only the Go files of a package in it are removed, and removes the record
+// when no files of the copy are left.
+func TestPruneRecords(t *testing.T) {
+	defer func() { opt.force = false }()
+	opt.force = true
+	for _, recorded := range [][]string{{"c"}, {"c", filepath.Join("c", "d")}} {
+		ctx := getTestContextCopy(t, filepath.Join("testdata", "prune"))
+		defer os.RemoveAll(ctx.GOPATH)
+		pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+		libDir := filepath.Join(pkgDir, "lib")
+		// Record the subdirectories first, so the copy of the parent
+		// directory does not hash them.
+		for i := len(recorded) - 1; i >= 0; i-- {
+			d := filepath.Join(libDir, recorded[i])
+			if err := recordDir(d, d, &record{Origin: "other.com/" + recorded[i]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := prune(ctx, pkgDir, "lib"); err != nil {
+			t.Fatalf("error during prune : %s", err.Error())
+		}
+		cDir := filepath.Join(libDir, "c")
+		testExists(t, filepath.Join(cDir, "c.go"), false)
+		testExists(t, filepath.Join(cDir, "d", "d.go"), true)
+		if len(recorded) > 1 {
+			testExists(t, filepath.Join(cDir, recordName), false)
+			testExists(t, filepath.Join(cDir, "d", recordName), true)
+			continue
+		}
+		rec, err := readRecord(cDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := rec.Files["c.go"]; ok || len(rec.Files["d/d.go"]) == 0 || len(rec.Files) != 1 {
+			t.Errorf("%v : got files %v, expected only d/d.go", recorded, rec.Files)
+		}
+	}
+}
+
+// TestPruneList tests that the prune subcommand does not remove anything
+// without the force option.
+func TestPruneList(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "prune"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	libDir := filepath.Join(pkgDir, "lib")
+	if err := prune(ctx, pkgDir, "lib"); err != nil {
+		t.Fatalf("error during prune : %s", err.Error())
+	}
+	testExists(t, filepath.Join(libDir, "c", "c.go"), true)
+	testExists(t, filepath.Join(libDir, "e", "e.go"), true)
+	testExists(t, filepath.Join(libDir, "f", "f.go"), true)
+}
+
+// TestPruneDefault tests the prune subcommand on the current working
+// directory, the default, checking that only the unused packages holding a
+// record are removed.
+func TestPruneDefault(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "prune"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func() { opt.force = false }()
+	opt.force = true
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	libDir := filepath.Join(pkgDir, "lib")
+	for _, d := range []string{"e", "f"} {
+		if err := writeRecord(filepath.Join(libDir, d), &record{Origin: "other.com/" + d}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := prune(ctx, pkgDir, "."); err != nil {
+		t.Fatalf("error during prune : %s", err.Error())
+	}
+	testExists(t, filepath.Join(pkgDir, "x.go"), true)
+	testExists(t, filepath.Join(libDir, "c", "c.go"), true)
+	testExists(t, filepath.Join(libDir, "e"), false)
+	testExists(t, filepath.Join(libDir, "f"), false)
+}
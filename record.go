@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// recordName is the name of the file placed in the root directory of a copied
+// package that records information about the copy.
+const recordName = ".vendored.json"
+
+// record holds information about a copied package, it is stored in the root
+// directory of the copy.
+type record struct {
+	// Origin is the import path of the package that was copied.
+	Origin string `json:"origin"`
+	// Files maps the slash separated path of each file, relative to the
+	// root directory of the copy, to the hex encoded SHA-256 digest of its
+	// contents.
+	Files map[string]string `json:"files"`
+	// Source maps the slash separated path of each file copied from the
+	// source directory to the hex encoded SHA-256 digest of its contents
+	// at the time of the copy.
+	Source map[string]string `json:"source"`
+	// Hidden is whether hidden files were included in the copy.
+	Hidden bool `json:"hidden"`
+	// Canonical is whether canonical import paths were rewritten in the
+	// copy, instead of being stripped.
+	Canonical bool `json:"canonical"`
+	// Group is whether the imports of rewritten files in the copy were
+	// regrouped.
+	Group bool `json:"group"`
+	// VCS is the repository and revision the package was copied or
+	// exported from, if any.
+	VCS *vcsInfo `json:"vcs,omitempty"`
+}
+
+// vcsInfo holds the version control state a package was copied from.
+type vcsInfo struct {
+	// Type is the version control system, such as "git".
+	Type string `json:"type"`
+	// Repo is the absolute path of the repository, the root of the working
+	// copy.
+	Repo string `json:"repo"`
+	// Rev is the full identifier of the revision.
+	Rev string `json:"rev"`
+	// Dirty is whether the working copy had uncommitted changes.
+	Dirty bool `json:"dirty"`
+	// Exported is whether the package was exported from the revision of
+	// the repository, by get, rather than copied from the working copy.
+	Exported bool `json:"exported,omitempty"`
+}
+
+// recordDir hashes all the files in the directory, the copy, and the files in
+// the source directory it was copied from, sets the digests on the passed
+// record and writes it into the directory.
+// Includes hidden files in the source directory based on the record.
+func recordDir(dir, src string, r *record) (err error) {
+	if r.Files, err = hashDir(dir); err != nil {
+		return err
+	}
+	if r.Source, err = hashSource(src, r.Hidden); err != nil {
+		return err
+	}
+	return writeRecord(dir, r)
+}
+
+// hashSource hashes the files copied from the source directory, returns a map
+// of the slash separated paths relative to the directory to the hex encoded
+// SHA-256 digest of the file contents.
+// Includes hidden files based on the `hidden` parameter.
+func hashSource(src string, hidden bool) (map[string]string, error) {
+	files, err := listFiles(src, hidden)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string)
+	for rel, path := range files {
+		if sums[rel], err = hashFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return sums, nil
+}
+
+// readRecord reads the record stored in the directory.
+func readRecord(dir string) (*record, error) {
+	src, err := getFileContents(filepath.Join(dir, recordName))
+	if err != nil {
+		return nil, err
+	}
+	r := &record{}
+	if err := json.Unmarshal(src, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// writeRecord writes the record into the directory, replacing an existing
+// record.
+func writeRecord(dir string, r *record) error {
+	out, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+	return writeFile(filepath.Join(dir, recordName), out, 0644)
+}
+
+// hasRecord checks if the directory contains a record.
+func hasRecord(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, recordName))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// findRecords returns a sorted list of all the directories, starting with the
+// specified directory, that contain a record.
+func findRecords(dir string) ([]string, error) {
+	dirs := make([]string, 0)
+	walk := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Name() != recordName {
+			return nil
+		}
+		dirs = append(dirs, filepath.Dir(path))
+		return nil
+	}
+	if err := filepath.Walk(dir, walk); err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// hashDir hashes all the regular files in the directory and its subdirectories,
+// returns a map of the slash separated paths relative to the directory to the
+// hex encoded SHA-256 digest of the file contents.
+// Skips records and subdirectories that contain their own record, as those
+// hold other copies.
+func hashDir(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	walk := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir() && path != dir && hasRecord(path):
+			return filepath.SkipDir
+		case !info.Mode().IsRegular() || info.Name() == recordName:
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = sum
+		return nil
+	}
+	if err := filepath.Walk(dir, walk); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// hashFile returns the hex encoded SHA-256 digest of the file contents.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// compareDigests compares the recorded digests to the current digests, both
+// map file paths to digests, and returns sorted lists of the file paths that
+// were added, removed, and modified.
+func compareDigests(recorded, current map[string]string) (added, removed, modified []string) {
+	for f, sum := range current {
+		if rsum, ok := recorded[f]; !ok {
+			added = append(added, f)
+		} else if rsum != sum {
+			modified = append(modified, f)
+		}
+	}
+	for f := range recorded {
+		if _, ok := current[f]; !ok {
+			removed = append(removed, f)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+	return added, removed, modified
+}
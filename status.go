@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/emil2k/vend/lib/ansi"
+)
+
+// pkgStatus holds the state of a copied package.
+type pkgStatus struct {
+	// Dir is the directory of the copy relative to the current working
+	// directory.
+	Dir string `json:"dir"`
+	// ImportPath is the import path of the copy.
+	ImportPath string `json:"import_path"`
+	// Origin is the import path the package was copied from.
+	Origin string `json:"origin"`
+	// Modified lists the files that differ from the recorded digests.
+	Modified []string `json:"modified"`
+	// UpstreamNewer is whether the source files in the GOPATH changed since
+	// the copy was made.
+	UpstreamNewer bool `json:"upstream_newer"`
+	// UpstreamMissing is whether the source could not be found in the
+	// GOPATH.
+	UpstreamMissing bool `json:"upstream_missing"`
+	// Unused is whether the copy and its child packages are not imported by
+	// any package outside of the copy.
+	Unused bool `json:"unused"`
+	// Leaks lists the imports of the copy that are not standard, not
+	// located in the project, and not copied.
+	Leaks []string `json:"leaks"`
+}
+
+// clean checks whether the copied package is in a healthy state.
+func (s *pkgStatus) clean() bool {
+	return len(s.Modified) == 0 && !s.UpstreamNewer && !s.UpstreamMissing &&
+		!s.Unused && len(s.Leaks) == 0
+}
+
+// status runs the status subcommand, outputs the state of every copied package
+// located in the `dir` directory, relative paths are resolved from the current
+// working directory, which is expected to hold the project's package.
+// With the opt.json option set outputs the states in JSON.
+func status(ctx *build.Context, cwd, dir string) error {
+	sts, err := getStatus(ctx, cwd, dir)
+	if err != nil {
+		return err
+	}
+	if opt.json {
+		out, err := json.MarshalIndent(sts, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	if len(sts) == 0 {
+		fmt.Println("No copied packages found.")
+		return nil
+	}
+	for _, s := range sts {
+		printBold(fmt.Sprintf("%s (%s)", s.Dir, s.Origin))
+		if s.clean() {
+			fmt.Println(ansi.Color("\tclean", "green"))
+			continue
+		}
+		for _, f := range s.Modified {
+			fmt.Println(ansi.Color("\tmodified :   "+f, "red"))
+		}
+		if s.UpstreamNewer {
+			fmt.Println(ansi.Color("\tupstream newer", "yellow"))
+		}
+		if s.UpstreamMissing {
+			fmt.Println(ansi.Color("\tupstream missing", "yellow"))
+		}
+		if s.Unused {
+			fmt.Println(ansi.Color("\tunused", "yellow"))
+		}
+		for _, l := range s.Leaks {
+			fmt.Println(ansi.Color("\tleaking :    "+l, "red"))
+		}
+	}
+	return nil
+}
+
+// getStatus compiles the states of every copied package located in the `dir`
+// directory, see status.
+func getStatus(ctx *build.Context, cwd, dir string) ([]*pkgStatus, error) {
+	dir, err := cwdAbs(cwd, dir)
+	if err != nil {
+		return nil, err
+	}
+	projectImp, err := getImportPath(ctx, cwd, cwd)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := findRecords(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Determine the import paths of all the copies.
+	sts := make([]*pkgStatus, 0, len(dirs))
+	copies := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		imp, err := getImportPath(ctx, cwd, d)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(cwd, d)
+		if err != nil {
+			rel = d
+		}
+		sts = append(sts, &pkgStatus{Dir: rel, ImportPath: imp})
+		copies = append(copies, imp)
+	}
+	// Gather the packages in the project and in the copies, to determine
+	// usage and leaks.
+	pkgs := make([]*build.Package, 0)
+	process := func(pkg *build.Package, _ error) error {
+		if len(pkg.ImportPath) > 0 && len(pkg.Name) > 0 {
+			pkgs = append(pkgs, pkg)
+		}
+		return nil
+	}
+	if err := recursePackages(context.Background(), ctx, cwd, process); err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		if !isChildDir(cwd, d) {
+			if err := recursePackages(context.Background(), ctx, d, process); err != nil {
+				return nil, err
+			}
+		}
+	}
+	leak := leakFilter(ctx, cwd, projectImp, copies)
+	for i, d := range dirs {
+		s := sts[i]
+		r, err := readRecord(d)
+		if err != nil {
+			return nil, fmt.Errorf("can't read record in %s : %s", d, err.Error())
+		}
+		s.Origin = r.Origin
+		// Local modifications.
+		files, err := hashDir(d)
+		if err != nil {
+			return nil, err
+		}
+		added, removed, modified := compareDigests(r.Files, files)
+		s.Modified = append(append(added, removed...), modified...)
+		sort.Strings(s.Modified)
+		// Upstream changes, copies made by get are compared with the
+		// revision they recorded.
+		srcDir, err := exportRecord(r)
+		exported := err == nil && len(srcDir) > 0
+		if err == nil && !exported {
+			srcPkg, _ := getPackage(ctx, cwd, r.Origin)
+			srcDir = srcPkg.Dir
+		}
+		if len(srcDir) == 0 {
+			s.UpstreamMissing = true
+		} else {
+			source, err := hashSource(srcDir, r.Hidden)
+			if exported {
+				os.RemoveAll(srcDir)
+			}
+			if err != nil {
+				return nil, err
+			}
+			added, removed, modified := compareDigests(r.Source, source)
+			s.UpstreamNewer = len(added)+len(removed)+len(modified) > 0
+		}
+		// Usage and leaks.
+		s.Unused = true
+		for _, pkg := range pkgs {
+			inCopy := isImportIn(s.ImportPath, pkg.ImportPath)
+			for _, imp := range getImports(pkg, true) {
+				if !inCopy && isImportIn(s.ImportPath, imp) {
+					s.Unused = false
+				}
+			}
+			if !inCopy {
+				continue
+			}
+			for _, imp := range filterImports(getImports(pkg, false), leak) {
+				s.Leaks = appendUnique(s.Leaks, imp)
+			}
+		}
+		sort.Strings(s.Leaks)
+	}
+	return sts, nil
+}
+
+// leakFilter makes an import filter that passes imports that are not standard
+// packages, not located in the project specified by its import path, and not
+// located in any of the copies specified by their import paths.
+func leakFilter(ctx *build.Context, cwd, project string, copies []string) func(i string) bool {
+	return func(i string) bool {
+		switch {
+		case isImportIn(project, i):
+			return false
+		case isStandardPackage(ctx, cwd, i):
+			return false
+		}
+		for _, c := range copies {
+			if isImportIn(c, i) {
+				return false
+			}
+		}
+		return true
+	}
+}
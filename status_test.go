@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStatus tests the states compiled for the status subcommand, checking a
+// fresh copy is clean and then that local modifications, leaking imports, and
+// upstream changes are detected.
+func TestStatus(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	srcDir := filepath.Join(ctx.GOPATH, "src", "other.com", "y")
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"), dstDir, false, false)
+	if err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	sts, err := getStatus(ctx, pkgDir, ".")
+	if err != nil {
+		t.Fatalf("error getting status : %s", err.Error())
+	} else if len(sts) != 1 {
+		t.Fatalf("expected one copy, got %d", len(sts))
+	}
+	s := sts[0]
+	if s.Dir != filepath.Join("lib", "y") || s.ImportPath != "example.com/x/lib/y" ||
+		s.Origin != "other.com/y" {
+		t.Errorf("unexpected copy : %+v", s)
+	}
+	if !s.clean() {
+		t.Errorf("fresh copy not clean : %+v", s)
+	}
+	// Add a file with an import that is not copied, and modify upstream.
+	leak := []byte("package y\n\nimport _ \"other.com/z\"\n")
+	if err := ioutil.WriteFile(filepath.Join(dstDir, "leak.go"), leak, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(srcDir, "new.go"), []byte("package y\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if sts, err = getStatus(ctx, pkgDir, "."); err != nil {
+		t.Fatalf("error getting status : %s", err.Error())
+	}
+	s = sts[0]
+	testStrings(t, "modified", s.Modified, []string{"leak.go"})
+	testStrings(t, "leaks", s.Leaks, []string{"other.com/z"})
+	if !s.UpstreamNewer {
+		t.Errorf("upstream change not detected")
+	}
+	if s.Unused {
+		t.Errorf("copy should be used")
+	}
+}
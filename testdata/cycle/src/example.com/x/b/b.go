@@ -0,0 +1,6 @@
+// Package b is a child package of x that imports another child package.
+package b
+
+import (
+	_ "example.com/x/c"
+)
@@ -0,0 +1,6 @@
+// Package c is a child package of x that imports an external package.
+package c
+
+import (
+	_ "other.com/d"
+)
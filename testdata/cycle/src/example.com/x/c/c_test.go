@@ -0,0 +1,5 @@
+package c_test
+
+import (
+	_ "example.com/x"
+)
@@ -0,0 +1,6 @@
+// Package x is used for testing the prediction of import cycles.
+package x
+
+import (
+	_ "example.com/x/b"
+)
@@ -0,0 +1,2 @@
+// Package d is an external package.
+package d
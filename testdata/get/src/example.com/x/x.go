@@ -0,0 +1,5 @@
+package x
+
+import "other.com/r"
+
+var _ = r.V
@@ -0,0 +1,6 @@
+// Package a is a vendored package imported directly by x.
+package a
+
+import (
+	_ "example.com/x/lib/b"
+)
@@ -0,0 +1,2 @@
+// Package b is a vendored package imported only by another vendored package.
+package b
@@ -0,0 +1,7 @@
+// Package c is a vendored package that is no longer imported, but it contains
+// a package in a subdirectory that is still used.
+package c
+
+import (
+	_ "example.com/x/lib/b"
+)
@@ -0,0 +1,3 @@
+// Package d is a vendored package imported only by a test of a child package
+// of x.
+package d
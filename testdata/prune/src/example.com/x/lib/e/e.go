@@ -0,0 +1,6 @@
+// Package e is a vendored package that is no longer imported.
+package e
+
+import (
+	_ "example.com/x/lib/f"
+)
@@ -0,0 +1,2 @@
+// Package f is a vendored package imported only by an unused vendored package.
+package f
@@ -0,0 +1,6 @@
+// Package x is used for testing the prune command.
+package x
+
+import (
+	_ "example.com/x/lib/a"
+)
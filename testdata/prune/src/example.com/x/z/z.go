@@ -0,0 +1,3 @@
+// Package z is a child package of x, its test imports another vendored
+// package.
+package z
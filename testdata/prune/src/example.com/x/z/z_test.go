@@ -0,0 +1,5 @@
+package z
+
+import (
+	_ "example.com/x/lib/c/d"
+)
@@ -11,13 +11,38 @@ Valid subcommands :
   vend init
   vend cp
   vend mv
+  vend get
   vend path
+  vend prune
+  vend verify
+  vend diff
+  vend patch
+  vend status
+  vend check
   vend list
   vend info
+  vend why
+  vend completion
 
 For help with subcommands run :
 
   vend [subcommand] -h
+
+Defaults for the -r, -i, -f, and -v flags, the directory of copied packages,
+exclude patterns, and naming overrides are read from a .vend.toml or .vend.json
+file in the project's root directory, and from VEND_* environment variables.
+
+Other subcommands run a vend-[subcommand] executable found on the PATH, with
+the import path and directory of the package in the current working directory
+and the GOPATH in the VEND_IMPORT_PATH, VEND_PKG_DIR, and VEND_GOPATH
+environment variables.
+
+Subcommands that make changes lock the project with a .vend.lock file in the
+project's root directory, run them with -wait to wait for another process
+holding it.
+
+On an interrupt the init, cp, mv, get, and path subcommands finish the current
+file, keep the completed work, and report what was not done.
 `
 
 // listUsage describes usage of the list subcommand.
@@ -40,6 +65,16 @@ GOPATH.
   vend info [arguments] [path]
 `
 
+// whyUsage describes usage of the why subcommand.
+const whyUsage string = `
+Explains why the package specified by the [path] import path is a dependency,
+printing the shortest chain of imports from the package in the current working
+directory to it. Packages only imported by the test files of the previous
+package in the chain are marked with (test).
+
+  vend why [arguments] [path]
+`
+
 // initUsage describes usage of the init subcommand.
 const initUsage string = `
 For the package in the current working directory copies all external packages
@@ -51,7 +86,11 @@ The packages are copied into a subdirectory specified by the package name. If
 multiple dependencies have the same package name the command will fail and
 provide all the duplicates, the user should use the vend cp command to place
 those packages in unique directories before running vend init again to process
-the other packages.
+the other packages. With the -interactive flag, when the standard input is a
+terminal, the command prompts for a unique name for each of the duplicates
+instead, saving the choices in the project's configuration for the next run.
+
+If the [directory] is omitted the directory set in the configuration is used.
 
   vend init [directory]
 `
@@ -62,6 +101,11 @@ Copies the package in the [from] import path or directory to the [to]
 directory, updating the necessary import paths for the package in the current
 working directory.
 
+Validates the copy before making any changes, reporting every problem found.
+With -sync only the files of an existing copy that differ are replaced.
+With -copy-mode=hardlink or reflink files are linked or share their contents
+with the source where possible, instead of being copied.
+
   vend cp [from] [to]
 `
 
@@ -75,6 +119,20 @@ cp instead.
   vend mv [from] [to]
 `
 
+// getUsage describes usage of the get subcommand.
+const getUsage string = `
+Exports the package at the [rev] revision, a commit or a tag, of the local Git
+repository at [repo], a directory or a file:// URL, into the [to] directory,
+updating the necessary import paths for the package in the current working
+directory. The package does not need to be present in the GOPATH.
+
+The import path of the package is determined from the canonical import path in
+the root of the repository, or set with the -import flag. The repository and
+the commit are recorded in the copy.
+
+  vend get [repo] [rev] [to]
+`
+
 // pathUsage describes usage of the path subcommand.
 const pathUsage string = `
 Updates all the usages of the import path [from] to the import path [to] for
@@ -82,5 +140,112 @@ the package in the current working directory. When updating it includes import
 paths located in subdirectories of the [from] import path, updating them to
 their corresponding location in the [to] import path.
 
+If a rewritten import duplicates another import in the same file the imports
+are merged, updating qualified identifiers to use a single package name.
+If the package name of a rewritten import changes, the old package name is added
+as the import name to preserve the qualified identifiers, use the -selectors flag
+to rename the qualified identifiers instead.
+
+Fails before making any changes if the updated imports would form an import
+cycle, use the -allow-cycles flag to only print a warning.
+
   vend path [from] [to]
 `
+
+// pruneUsage describes usage of the prune subcommand.
+const pruneUsage string = `
+Lists the packages located in the vendor [directory] that are no longer
+imported by the package in the current working directory or any of the packages
+in its subdirectories, either directly or through other vendored packages. The
+packages are removed when run with the -f flag, updating the records of the
+copies holding them.
+
+If the [directory] is omitted the directory set in the configuration is used,
+or the current working directory, in which case only the copied packages,
+holding a record, are considered vendored.
+
+  vend prune [directory]
+`
+
+// verifyUsage describes usage of the verify subcommand.
+const verifyUsage string = `
+Checks the files of every copied package located in the [directory], if
+omitted defaults to the current working directory, against the digests
+recorded when the package was copied. Reports the added, removed, and modified
+files for each package and exits with an error if any are found. Run with the
+-update flag to accept the changes.
+
+  vend verify [arguments] [directory]
+`
+
+// diffUsage describes usage of the diff subcommand.
+const diffUsage string = `
+Outputs a unified diff from the upstream package specified by the [upstream]
+path to its copy in the vendored [directory]. The [upstream] path can be
+specified relative to the current working directory or as an import path
+resolved through the GOPATH, if omitted defaults to the import path the copy
+was made from, or for copies made by vend get to the repository and the
+revision they recorded. The canonical import path is stripped and the import
+paths of the copied package are updated in the upstream files before comparing,
+so only the local modifications to the copy are shown. Hidden files are
+compared when the copy was made with them, the -i flag only applies to copies
+without a record.
+
+  vend diff [arguments] [directory] [upstream]
+`
+
+// patchUsage describes usage of the patch subcommand.
+const patchUsage string = `
+Maintains local modifications to the copied package located in the [directory]
+as a patch file in the patches directory in the project's root directory, named
+after the path of the [directory] from it, such as patches/lib/pq.patch.
+
+The save action saves the differences between the upstream package, with the
+changes made by cp applied, and the copy, see diff. The apply action applies
+the saved patch, after the package is copied again. Hunks are applied at the
+nearest position their context matches, if any hunk fails no files are changed
+and the failing hunks are reported with the context they expected. The digests
+recorded in the copy are updated to accept the patched files.
+
+  vend patch [arguments] save|apply [directory]
+`
+
+// statusUsage describes usage of the status subcommand.
+const statusUsage string = `
+Outputs the state of every copied package located in the [directory], if
+omitted defaults to the current working directory. For each copy lists the
+import path it was copied from, the files modified since it was recorded,
+whether the upstream package in the GOPATH, or the revision recorded by
+vend get, changed since the copy was made,
+whether the copy is unused in the package in the current working directory and
+its subdirectories, and the imports of the copy that are neither standard,
+located in the project, or copied.
+
+  vend status [arguments] [directory]
+`
+
+// checkUsage describes usage of the check subcommand.
+const checkUsage string = `
+Outputs the position of every import of the packages located in the
+[directory], if omitted defaults to the current working directory, that is
+neither standard, located in the project, or copied. Exits with an error if
+any are found.
+
+With the -fix flag rewrites the leaking imports of packages that have been
+copied to import their copy, updating the records of the changed copies.
+
+  vend check [arguments] [directory]
+`
+
+// completionUsage describes usage of the completion subcommand.
+const completionUsage string = `
+Outputs the completion script for the [shell], either bash, zsh, or fish,
+completing subcommands, flags, import paths found in the GOPATH, copied
+packages in the project, and directories.
+
+  vend completion [shell]
+
+To enable completion in bash add to ~/.bashrc :
+
+  eval "$(vend completion bash)"
+`
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -74,3 +76,42 @@ func cwdAbs(base, path string) (string, error) {
 	}
 	return filepath.Join(base, path), nil
 }
+
+// isChildDir checks if the child directory is the parent directory or is
+// located inside of it. Pass in absolute paths for both.
+func isChildDir(parent, child string) bool {
+	rel, err := filepath.Rel(parent, child)
+	if err != nil {
+		return false
+	}
+	return rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// writeFile writes the data into the file at the `path` through a temporary
+// file in the same directory renamed over it, so an interrupted write never
+// leaves a truncated file behind. Keeps the mode of an existing file, otherwise
+// uses the `perm` mode.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".vend-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
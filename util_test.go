@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"go/build"
 	"io/ioutil"
 	"os"
@@ -36,7 +37,7 @@ func testImports(t *testing.T, dir string, imports []string, includeTests bool)
 // In case of error immediately failst the test.
 func getTestContextCopy(t *testing.T, src string) *build.Context {
 	ctx := getTestContext(t)
-	if err := copyDir(src, ctx.GOPATH, true); err != nil {
+	if err := copyDir(context.Background(), src, ctx.GOPATH, true, nil); err != nil {
 		t.Errorf("error while copying GOPATH : %s", err.Error())
 		t.FailNow()
 	}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// detectVCS detects whether the directory is located inside a Git or a
+// Mercurial working copy, by walking up to find a .git or .hg entry, and reads
+// the revision checked out and whether there are uncommitted changes in the
+// directory.
+// The revision is read with the git or hg binary, if it is not found the
+// repository metadata is parsed instead, in which case uncommitted changes are
+// not detected.
+// Returns nil if the directory is not inside a working copy.
+func detectVCS(dir string) (*vcsInfo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgDir := dir
+	for {
+		if info, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			v := &vcsInfo{Type: "git", Repo: dir}
+			if info.IsDir() || info.Mode().IsRegular() {
+				return v, readGit(v, pkgDir)
+			}
+		}
+		if info, err := os.Stat(filepath.Join(dir, ".hg")); err == nil && info.IsDir() {
+			v := &vcsInfo{Type: "hg", Repo: dir}
+			return v, readHg(v)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// readGit sets the revision of the Git working copy, and the dirty state of the
+// directory inside it, changes elsewhere in the working copy are ignored.
+func readGit(v *vcsInfo, dir string) error {
+	out, err := git(v.Repo, nil, "rev-parse", "--verify", "HEAD")
+	if isNotFound(err) {
+		v.Rev, err = gitHead(v.Repo)
+		return err
+	} else if err != nil {
+		return err
+	}
+	v.Rev = strings.TrimSpace(string(out))
+	rel, err := filepath.Rel(v.Repo, dir)
+	if err != nil {
+		return err
+	}
+	if out, err = git(v.Repo, nil, "status", "--porcelain", "--", filepath.ToSlash(rel)); err != nil {
+		return err
+	}
+	v.Dirty = len(bytes.TrimSpace(out)) > 0
+	return nil
+}
+
+// readHg sets the revision and the dirty state of the Mercurial working copy.
+func readHg(v *vcsInfo) error {
+	out, err := vcsCommand(v.Repo, nil, "hg", "id", "--debug", "-i")
+	if isNotFound(err) {
+		v.Rev, err = hgParent(v.Repo)
+		return err
+	} else if err != nil {
+		return err
+	}
+	// A plus sign is appended to the revision if there are uncommitted
+	// changes.
+	id := strings.TrimSpace(string(out))
+	v.Rev, v.Dirty = strings.TrimSuffix(id, "+"), strings.HasSuffix(id, "+")
+	return nil
+}
+
+// gitHead reads the revision of HEAD from the metadata of the Git working copy
+// located at `repo`, following a symbolic reference to a loose or a packed
+// reference.
+func gitHead(repo string) (string, error) {
+	gitDir, err := gitDirPath(repo)
+	if err != nil {
+		return "", err
+	}
+	head, err := getFileContents(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	ref := strings.TrimSpace(string(head))
+	if !strings.HasPrefix(ref, "ref:") {
+		return ref, nil // detached
+	}
+	ref = strings.TrimSpace(strings.TrimPrefix(ref, "ref:"))
+	// References are shared between linked working trees, through the
+	// common directory.
+	dirs := []string{gitDir}
+	if common, err := getFileContents(filepath.Join(gitDir, "commondir")); err == nil {
+		c := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(c) {
+			c = filepath.Join(gitDir, c)
+		}
+		dirs = append(dirs, c)
+	}
+	for _, d := range dirs {
+		if rev, err := getFileContents(filepath.Join(d, filepath.FromSlash(ref))); err == nil {
+			return strings.TrimSpace(string(rev)), nil
+		}
+	}
+	for _, d := range dirs {
+		if rev, ok, err := packedRef(filepath.Join(d, "packed-refs"), ref); err != nil {
+			return "", err
+		} else if ok {
+			return rev, nil
+		}
+	}
+	return "", fmt.Errorf("reference %s not found in %s", ref, gitDir)
+}
+
+// gitDirPath returns the Git directory of the working copy located at `repo`,
+// either the .git directory or the one referred to by a .git file.
+func gitDirPath(repo string) (string, error) {
+	dotGit := filepath.Join(repo, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return "", err
+	} else if info.IsDir() {
+		return dotGit, nil
+	}
+	src, err := getFileContents(dotGit)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(src))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("invalid %s", dotGit)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(repo, gitDir)
+	}
+	return gitDir, nil
+}
+
+// packedRef looks up the reference in the packed-refs file, returns whether it
+// was found. A missing file is not an error.
+func packedRef(path, ref string) (string, bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Lines are "<revision> <reference>", skipping comments and
+		// peeled tags starting with a caret.
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[1] == ref && !strings.HasPrefix(fields[0], "#") {
+			return fields[0], true, nil
+		}
+	}
+	return "", false, s.Err()
+}
+
+// hgParent reads the revision of the first parent of the Mercurial working
+// copy located at `repo`, stored in the first 20 bytes of the dirstate.
+func hgParent(repo string) (string, error) {
+	f, err := os.Open(filepath.Join(repo, ".hg", "dirstate"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	p := make([]byte, 20)
+	if _, err := io.ReadFull(f, p); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(p), nil
+}
+
+// git runs the git command with the arguments in the `repo` directory, see
+// vcsCommand.
+func git(repo string, w io.Writer, args ...string) ([]byte, error) {
+	return vcsCommand(repo, w, "git", args...)
+}
+
+// vcsCommand runs the named command with the arguments in the `dir` directory.
+// Writes the output to the writer, if not nil, otherwise returns it. The error
+// includes the error output of the command.
+func vcsCommand(dir string, w io.Writer, name string, args ...string) ([]byte, error) {
+	var out, errOut bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	if w != nil {
+		cmd.Stdout = w
+	}
+	if err := cmd.Run(); err != nil {
+		if ee, ok := err.(*exec.Error); ok {
+			return nil, ee
+		} else if msg := strings.TrimSpace(errOut.String()); len(msg) > 0 {
+			return nil, fmt.Errorf("%s %s : %s", name, args[0], msg)
+		}
+		return nil, fmt.Errorf("%s %s : %s", name, args[0], err.Error())
+	}
+	return out.Bytes(), nil
+}
+
+// isNotFound checks whether the error is returned by vcsCommand when the
+// binary is not found.
+func isNotFound(err error) bool {
+	ee, ok := err.(*exec.Error)
+	return ok && ee.Err == exec.ErrNotFound
+}
+
+// String formats the version control state for output.
+func (v *vcsInfo) String() string {
+	s := fmt.Sprintf("%s revision %s", v.Type, v.Rev)
+	if v.Dirty {
+		s += " with uncommitted changes"
+	}
+	return s
+}
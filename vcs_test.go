@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDetectVCS tests detecting the revision and the dirty state of a Git
+// working copy from one of its subdirectories, and that directories outside of
+// a working copy have none.
+func TestDetectVCS(t *testing.T) {
+	repo := testGitRepo(t, map[string]string{"a/a.go": "package a\n"})
+	defer os.RemoveAll(repo)
+	v, err := detectVCS(filepath.Join(repo, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev := testGit(t, repo, "rev-parse", "HEAD")
+	if v == nil || v.Type != "git" || v.Repo != repo || v.Rev != rev || v.Dirty {
+		t.Errorf("got %+v, expected clean git revision %s in %s", v, rev, repo)
+	}
+	// Changes outside of the directory are ignored.
+	if err := ioutil.WriteFile(filepath.Join(repo, "c.go"), []byte("package c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = detectVCS(filepath.Join(repo, "a")); err != nil {
+		t.Fatal(err)
+	} else if v == nil || v.Dirty {
+		t.Errorf("got %+v, expected clean with changes outside the directory", v)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repo, "a", "b.go"), []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = detectVCS(filepath.Join(repo, "a")); err != nil {
+		t.Fatal(err)
+	} else if v == nil || !v.Dirty {
+		t.Errorf("got %+v, expected dirty", v)
+	}
+	// Outside of a working copy.
+	dir, err := ioutil.TempDir("", "vend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if v, err := detectVCS(dir); err != nil || v != nil {
+		t.Errorf("got %+v and error %v, expected none", v, err)
+	}
+}
+
+// TestGitHead tests reading the revision of HEAD from the metadata of a Git
+// working copy, without the git binary.
+func TestGitHead(t *testing.T) {
+	repo, err := ioutil.TempDir("", "vend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repo)
+	gitDir := filepath.Join(repo, ".git")
+	write := func(name, src string) {
+		path := filepath.Join(gitDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(rev string) {
+		if got, err := gitHead(repo); err != nil {
+			t.Errorf("expected %s, got error %s", rev, err.Error())
+		} else if got != rev {
+			t.Errorf("got %s, expected %s", got, rev)
+		}
+	}
+	// Packed reference.
+	write("HEAD", "ref: refs/heads/main\n")
+	write("packed-refs", "# pack-refs with: peeled fully-peeled sorted\n"+
+		"1111111111111111111111111111111111111111 refs/heads/main\n"+
+		"2222222222222222222222222222222222222222 refs/tags/v1\n"+
+		"^3333333333333333333333333333333333333333\n")
+	expect("1111111111111111111111111111111111111111")
+	// Loose reference takes precedence.
+	write("refs/heads/main", "4444444444444444444444444444444444444444\n")
+	expect("4444444444444444444444444444444444444444")
+	// Detached HEAD.
+	write("HEAD", "5555555555555555555555555555555555555555\n")
+	expect("5555555555555555555555555555555555555555")
+	// Git directory referred to by a .git file.
+	if err := os.Rename(gitDir, filepath.Join(repo, "gitdir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(gitDir, []byte("gitdir: gitdir\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("5555555555555555555555555555555555555555")
+	// Missing reference.
+	if err := ioutil.WriteFile(filepath.Join(repo, "gitdir", "HEAD"), []byte("ref: refs/heads/none\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gitHead(repo); err == nil {
+		t.Error("expected error for missing reference")
+	}
+}
+
+// TestCpRecordsVCS tests that cp records the revision of the working copy the
+// source package is located in.
+func TestCpRecordsVCS(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	srcDir := filepath.Join(ctx.GOPATH, "src", "other.com", "y")
+	testGit(t, srcDir, "init", "-q")
+	testGit(t, srcDir, "add", "-A")
+	testGit(t, srcDir, "commit", "-q", "-m", "commit")
+	rev := testGit(t, srcDir, "rev-parse", "HEAD")
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	if err := cp(context.Background(), ctx, pkgDir, "other.com/y", filepath.Join("lib", "y"), false, false); err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	r, err := readRecord(filepath.Join(pkgDir, "lib", "y"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.VCS == nil || r.VCS.Type != "git" || r.VCS.Repo != srcDir ||
+		r.VCS.Rev != rev || r.VCS.Dirty {
+		t.Errorf("unexpected revision recorded : %+v", r.VCS)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// ErrDrift is returned by the verify subcommand when the files of a copied
+// package do not match the recorded digests.
+var ErrDrift = errors.New("copied packages modified since they were recorded")
+
+// verify runs the verify subcommand, recomputes the digests of the files of
+// every copied package located in the specified directory, relative paths are
+// resolved from the current working directory, and compares them to the
+// recorded digests.
+// Outputs the added, removed, and modified files for each package that does
+// not match and returns an ErrDrift.
+// With the opt.update option set the records are updated to accept the changes
+// instead.
+func verify(cwd, dir string) error {
+	dir, err := cwdAbs(cwd, dir)
+	if err != nil {
+		return err
+	}
+	dirs, err := findRecords(dir)
+	if err != nil {
+		return err
+	}
+	var drift bool
+	for _, d := range dirs {
+		r, err := readRecord(d)
+		if err != nil {
+			return fmt.Errorf("can't read record in %s : %s", d, err.Error())
+		}
+		files, err := hashDir(d)
+		if err != nil {
+			return err
+		}
+		added, removed, modified := compareDigests(r.Files, files)
+		rel, err := filepath.Rel(cwd, d)
+		if err != nil {
+			rel = d
+		}
+		if len(added)+len(removed)+len(modified) == 0 {
+			if opt.verbose {
+				printBold(fmt.Sprintf("%s (%s)", rel, r.Origin))
+				fmt.Println("ok")
+			}
+			continue
+		}
+		drift = true
+		printBold(fmt.Sprintf("%s (%s)", rel, r.Origin))
+		for _, f := range added {
+			fmt.Printf("added : %s\n", f)
+		}
+		for _, f := range removed {
+			fmt.Printf("removed : %s\n", f)
+		}
+		for _, f := range modified {
+			fmt.Printf("modified : %s\n", f)
+		}
+		if opt.update {
+			r.Files = files
+			if err := writeRecord(d, r); err != nil {
+				return err
+			}
+			fmt.Println("updated")
+		}
+	}
+	if drift && !opt.update {
+		return ErrDrift
+	}
+	return nil
+}
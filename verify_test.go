@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestVerify tests the verify subcommand, checking that a freshly copied
+// package verifies, that added, removed, and modified files are detected, and
+// that the changes are accepted with the update option.
+func TestVerify(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "cp"))
+	defer os.RemoveAll(ctx.GOPATH)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	dstDir := filepath.Join(pkgDir, "lib", "y")
+	err := cp(context.Background(), ctx, pkgDir, filepath.Join("other.com", "y"), dstDir, false, false)
+	if err != nil {
+		t.Fatalf("error during cp : %s", err.Error())
+	}
+	if err := verify(pkgDir, "lib"); err != nil {
+		t.Fatalf("error verifying fresh copy : %s", err.Error())
+	}
+	// Modify the copy and check what is detected.
+	if err := ioutil.WriteFile(filepath.Join(dstDir, "new.go"),
+		[]byte("package y\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dstDir, "y_test.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dstDir, "sub", "sub.go"),
+		[]byte("package sub\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := readRecord(dstDir)
+	if err != nil {
+		t.Fatalf("error reading record : %s", err.Error())
+	}
+	if r.Origin != "other.com/y" {
+		t.Errorf("origin : got %s, expected other.com/y", r.Origin)
+	}
+	files, err := hashDir(dstDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, removed, modified := compareDigests(r.Files, files)
+	testStrings(t, "added", added, []string{"new.go"})
+	testStrings(t, "removed", removed, []string{"y_test.go"})
+	testStrings(t, "modified", modified, []string{"sub/sub.go"})
+	if err := verify(pkgDir, "lib"); err != ErrDrift {
+		t.Errorf("verify modified copy : got %v, expected %v", err, ErrDrift)
+	}
+	// Accept the changes.
+	defer func() { opt.update = false }()
+	opt.update = true
+	if err := verify(pkgDir, "lib"); err != nil {
+		t.Errorf("error updating records : %s", err.Error())
+	}
+	opt.update = false
+	if err := verify(pkgDir, "lib"); err != nil {
+		t.Errorf("error verifying updated records : %s", err.Error())
+	}
+}
+
+// testStrings tests that the slice of strings matches expectations, the name
+// is used to describe the slice in the failure message.
+func testStrings(t *testing.T, name string, got, expected []string) {
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("%s : got %v, expected %v", name, got, expected)
+	}
+}
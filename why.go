@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+)
+
+// why runs the why subcommand, writing the shortest chain of imports from the
+// package in the current working directory, or any of the packages located in
+// its subdirectories if opt.recurse, to the package specified by the `path` to
+// the writer. Writes all the chains if opt.all. Packages only imported by the
+// test files of the previous package in the chain are marked.
+// Returns an error if the package is not imported.
+func why(ctx *build.Context, cwd, path string, w io.Writer) error {
+	target, std := path, false
+	// Resolve directories relative to the current working directory.
+	if abs, err := cwdAbs(cwd, path); err == nil {
+		if info, err := os.Stat(abs); err == nil && info.IsDir() {
+			path = abs
+		}
+	}
+	if pkg, _ := getPackage(ctx, cwd, path); len(pkg.ImportPath) > 0 && pkg.ImportPath != "." {
+		target, std = pkg.ImportPath, pkg.Goroot
+	}
+	roots := make([]*build.Package, 0)
+	if opt.recurse {
+		err := recursePackages(context.Background(), ctx, cwd, func(pkg *build.Package, err error) error {
+			if err == nil {
+				roots = append(roots, pkg)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else if pkg, err := getPackage(ctx, cwd, cwd); err != nil {
+		return err
+	} else {
+		roots = append(roots, pkg)
+	}
+	from := make([]string, 0, len(roots))
+	for _, pkg := range roots {
+		// The package itself does not explain why it is imported.
+		if pkg.ImportPath != target {
+			from = append(from, pkg.ImportPath)
+		}
+	}
+	g := buildImportGraph(ctx, cwd, roots, std)
+	var chains [][]importEdge
+	if opt.all {
+		chains = g.allChains(from, target)
+	} else if chain := g.shortestChain(from, target); chain != nil {
+		chains = [][]importEdge{chain}
+	}
+	if len(chains) == 0 {
+		return fmt.Errorf("%s is not imported", target)
+	}
+	fmt.Fprintf(w, "# %s\n", target)
+	for i, chain := range chains {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		for _, e := range chain {
+			if e.test {
+				fmt.Fprintf(w, "%s (test)\n", e.path)
+			} else {
+				fmt.Fprintln(w, e.path)
+			}
+		}
+	}
+	return nil
+}
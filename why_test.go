@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWhy tests explaining why packages are imported, with the shortest chain
+// or all the chains of imports, marking imports made by test files.
+func TestWhy(t *testing.T) {
+	ctx := getTestContextCopy(t, filepath.Join("testdata", "prune"))
+	defer os.RemoveAll(ctx.GOPATH)
+	defer func(recurse, all bool) {
+		opt.recurse, opt.all = recurse, all
+	}(opt.recurse, opt.all)
+	pkgDir := filepath.Join(ctx.GOPATH, "src", "example.com", "x")
+	tests := []struct {
+		path         string
+		recurse, all bool
+		expected     string
+	}{
+		{"example.com/x/lib/b", false, false,
+			"# example.com/x/lib/b\nexample.com/x\nexample.com/x/lib/a\nexample.com/x/lib/b\n"},
+		{"./lib/b", false, true,
+			"# example.com/x/lib/b\nexample.com/x\nexample.com/x/lib/a\nexample.com/x/lib/b\n"},
+		{"example.com/x/lib/c/d", true, false,
+			"# example.com/x/lib/c/d\nexample.com/x/z\nexample.com/x/lib/c/d (test)\n"},
+		{"example.com/x/lib/b", true, true,
+			"# example.com/x/lib/b\n" +
+				"example.com/x\nexample.com/x/lib/a\nexample.com/x/lib/b\n\n" +
+				"example.com/x/lib/a\nexample.com/x/lib/b\n\n" +
+				"example.com/x/lib/c\nexample.com/x/lib/b\n"},
+	}
+	for _, tt := range tests {
+		opt.recurse, opt.all = tt.recurse, tt.all
+		var buf bytes.Buffer
+		if err := why(ctx, pkgDir, tt.path, &buf); err != nil {
+			t.Errorf("%s : %s", tt.path, err.Error())
+		} else if buf.String() != tt.expected {
+			t.Errorf("%s : got\n%s\nexpected\n%s", tt.path, buf.String(), tt.expected)
+		}
+	}
+	// Packages that are not imported.
+	opt.recurse, opt.all = false, false
+	for _, path := range []string{"example.com/x/lib/c/d", "example.com/x/lib/f", "fmt"} {
+		if err := why(ctx, pkgDir, path, &bytes.Buffer{}); err == nil {
+			t.Errorf("%s : expected an error", path)
+		}
+	}
+}